@@ -0,0 +1,41 @@
+package wsclient
+
+// asyncQueueSize is the number of received messages waiting for a worker,
+// see WithAsyncHandlers, before reading from the server blocks
+const asyncQueueSize = 64
+
+// inboundFrame is a received data frame waiting for a worker
+type inboundFrame struct {
+	mt   int
+	data []byte
+}
+
+// WithAsyncHandlers makes the client pass the messages from the server to
+// OnMessage, OnTextMessage, OnBinaryMessage and OnUnhandledFrame from a pool
+// of workers goroutines instead of the goroutine reading from the
+// connection.
+//
+// By default a handler is called before the next message is read, so a slow
+// handler holds back reading, which in turn slows down the server, but
+// messages are handled one at a time and in order. With async handlers,
+// reading continues while handlers run, up to a queue of 64 messages, at the
+// cost of ordering: with more than one worker, messages can be handled
+// concurrently and complete out of order, so handlers must be safe for
+// concurrent use. Responses to SendAndWait and ReceiveJSON, and batches, see
+// WithBatchDelivery, are not affected.
+func WithAsyncHandlers(workers int) Option {
+	return func(c *WSClient) {
+		if workers < 1 {
+			workers = 1
+		}
+		c.asyncWorkers = workers
+	}
+}
+
+// handlerLoop dispatches the frames received on a connection until frames is
+// closed
+func (c *WSClient) handlerLoop(frames <-chan inboundFrame) {
+	for f := range frames {
+		c.dispatch(f.mt, f.data)
+	}
+}
@@ -0,0 +1,92 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncHandlers(t *testing.T) {
+	// read opens a client, blocks the handler of the first of 3 messages and
+	// returns how many were read from the connection in the meantime
+	read := func(opts ...Option) int64 {
+		u := newTestServer(t, func(conn *websocket.Conn) {
+			for i := 0; i < 3; i++ {
+				conn.WriteMessage(websocket.TextMessage, []byte("msg"))
+			}
+			conn.ReadMessage()
+		})
+
+		var n int64
+		release := make(chan bool)
+		handled := make(chan bool, 3)
+		ws := NewWSClient(u, opts...)
+		ws.OnBytesRead(func(int) {
+			atomic.AddInt64(&n, 1)
+		})
+		ws.OnMessage(func(data []byte) {
+			<-release
+			handled <- true
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if !assert.NoError(t, ws.Open(ctx)) {
+			return 0
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		read := atomic.LoadInt64(&n)
+		close(release)
+		for i := 0; i < 3; i++ {
+			select {
+			case <-handled:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the messages")
+			}
+		}
+		ws.Close()
+		waitShutdown(t, ws)
+		return read
+	}
+
+	assert.Equal(t, int64(1), read(), "inline handlers hold back reading")
+	assert.Equal(t, int64(3), read(WithAsyncHandlers(1)), "async handlers do not")
+}
+
+func TestAsyncHandlersOrder(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < 100; i++ {
+			conn.WriteJSON(M{"n": i})
+		}
+		conn.ReadMessage()
+	})
+
+	received := make(chan int, 100)
+	ws := NewWSClient(u, WithAsyncHandlers(1))
+	ws.OnMessage(func(data []byte) {
+		var m struct{ N int }
+		assert.NoError(t, json.Unmarshal(data, &m))
+		received <- m.N
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// a single worker keeps the order
+	for i := 0; i < 100; i++ {
+		select {
+		case n := <-received:
+			assert.Equal(t, i, n)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package wsclient
+
+import (
+	"encoding/json"
+)
+
+// autoPong describes the application-level ping messages answered by the
+// client, see WithAutoPongReply
+type autoPong struct {
+	pingType   string
+	pongType   string
+	echoFields []string
+}
+
+// WithAutoPongReply makes the client answer application-level pings sent by
+// the server. Every inbound JSON message whose type field (see WithTypeField)
+// equals pingType is answered with a message of type pongType that carries a
+// copy of echoFields from the ping, e.g. with pingType "ping", pongType
+// "pong" and echoFields ["ts"], {"type":"ping","ts":123} is answered with
+// {"type":"pong","ts":123}. Answered pings are not passed to OnMessage.
+// With WithReliableDelivery, the pongs are not numbered nor tracked.
+func WithAutoPongReply(pingType, pongType string, echoFields []string) Option {
+	return func(c *WSClient) {
+		c.autoPong = &autoPong{
+			pingType:   pingType,
+			pongType:   pongType,
+			echoFields: echoFields,
+		}
+	}
+}
+
+// replyPong answers data if it is an application-level ping. It returns
+// false if data is not a ping.
+func (c *WSClient) replyPong(data []byte) bool {
+	var ping M
+	if err := json.Unmarshal(data, &ping); err != nil {
+		return false
+	}
+	if t, _ := ping[c.typeField].(string); t != c.autoPong.pingType {
+		return false
+	}
+
+	pong := M{c.typeField: c.autoPong.pongType}
+	for _, f := range c.autoPong.echoFields {
+		if v, ok := ping[f]; ok {
+			pong[f] = v
+		}
+	}
+	// not numbered by WithReliableDelivery: servers do not ack pongs, so a
+	// tracked pong would stay pending and be replayed on every reconnect
+	m, err := c.encodeJSON(c.messageType, c.enrich(pong))
+	if err == nil {
+		err = c.enqueue(m)
+	}
+	if err != nil {
+		c.logf("auto pong: %s", err.Error())
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoPongReply(t *testing.T) {
+	pongs := make(chan M, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteJSON(M{"op": "ping", "ts": 123, "extra": true})
+		var pong M
+		if assert.NoError(t, conn.ReadJSON(&pong)) {
+			pongs <- pong
+		}
+		conn.WriteJSON(M{"op": "chat"})
+		conn.ReadMessage()
+	})
+
+	messages := make(chan []byte, 2)
+	ws := NewWSClient(u, WithTypeField("op"), WithAutoPongReply("ping", "pong", []string{"ts"}))
+	ws.OnMessage(func(data []byte) {
+		messages <- data
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case pong := <-pongs:
+		assert.Equal(t, M{"op": "pong", "ts": float64(123)}, pong)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pong")
+	}
+
+	// the ping is consumed, only the chat message reaches OnMessage
+	select {
+	case data := <-messages:
+		assert.JSONEq(t, `{"op":"chat"}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func TestAutoPongReplyReliable(t *testing.T) {
+	pongs := make(chan M, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteJSON(M{"op": "ping", "ts": 123})
+		var pong M
+		if assert.NoError(t, conn.ReadJSON(&pong)) {
+			pongs <- pong
+		}
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u, WithTypeField("op"), WithReliableDelivery("ack"),
+		WithAutoPongReply("ping", "pong", []string{"ts"}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// the pong carries no sequence number and is not waiting for an ack
+	select {
+	case pong := <-pongs:
+		assert.Equal(t, M{"op": "pong", "ts": float64(123)}, pong)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pong")
+	}
+	assert.Empty(t, ws.PendingAcks())
+}
@@ -0,0 +1,67 @@
+package wsclient
+
+import "time"
+
+// Backoff is a schedule of the delays between reconnect attempts, see
+// WithBackoff
+type Backoff interface {
+	// NextDelay returns the delay before attempt, counted from 1 after the
+	// connection was lost
+	NextDelay(attempt int) time.Duration
+	// Reset is called once the connection is re-established
+	Reset()
+}
+
+// WithBackoff sets the schedule of the delays between reconnect attempts,
+// instead of the exponential backoff from ReconnectConfig.InitialDelay to
+// ReconnectConfig.MaxDelay. The other settings of ReconnectConfig still
+// apply; it has no effect without WithReconnect. The reconnect loop calls it
+// from one goroutine at a time.
+func WithBackoff(b Backoff) Option {
+	return func(c *WSClient) {
+		c.backoff = b
+	}
+}
+
+// ExponentialBackoff is a Backoff starting with Initial and doubling after
+// each attempt up to Max, the default of ReconnectConfig
+type ExponentialBackoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// NextDelay returns Initial doubled attempt-1 times, capped at Max
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// Reset does nothing: the delay only depends on the attempt
+func (b ExponentialBackoff) Reset() {}
+
+// ConstantBackoff is a Backoff waiting Delay before every attempt
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// NextDelay returns Delay
+func (b ConstantBackoff) NextDelay(attempt int) time.Duration {
+	return b.Delay
+}
+
+// Reset does nothing
+func (b ConstantBackoff) Reset() {}
+
+// reconnectBackoff returns the schedule of the reconnect loop
+func (c *WSClient) reconnectBackoff() Backoff {
+	if c.backoff != nil {
+		return c.backoff
+	}
+	return ExponentialBackoff{Initial: c.reconnect.InitialDelay, Max: c.reconnect.MaxDelay}
+}
@@ -0,0 +1,107 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedBackoff returns the delays of schedule and records the attempts it
+// is asked about
+type recordedBackoff struct {
+	schedule []time.Duration
+	mu       sync.Mutex
+	attempts []int
+	resets   int
+}
+
+func (b *recordedBackoff) NextDelay(attempt int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts = append(b.attempts, attempt)
+	return b.schedule[attempt-1]
+}
+
+func (b *recordedBackoff) Reset() {
+	b.mu.Lock()
+	b.resets++
+	b.mu.Unlock()
+}
+
+func TestBackoff(t *testing.T) {
+	var conns int32
+	dials := make(chan time.Time, 5)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&conns, 1)
+		dials <- time.Now()
+		if n > 1 && n < 4 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if n == 1 {
+			// drop the first connection right away
+			return
+		}
+		conn.ReadMessage()
+	}))
+	defer s.Close()
+
+	b := &recordedBackoff{schedule: []time.Duration{150 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond}}
+	reconnected := make(chan bool)
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{}),
+		WithBackoff(b))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	b.mu.Lock()
+	assert.Equal(t, []int{1, 2, 3}, b.attempts)
+	assert.Equal(t, 1, b.resets)
+	b.mu.Unlock()
+
+	prev := <-dials
+	for i := 0; i < 3; i++ {
+		next := <-dials
+		gap := next.Sub(prev)
+		want := b.schedule[i]
+		assert.True(t, gap >= want && gap < want+500*time.Millisecond, "attempt %d after %s, want %s", i+1, gap, want)
+		prev = next
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second}
+	var got []time.Duration
+	for attempt := 1; attempt <= 5; attempt++ {
+		got = append(got, b.NextDelay(attempt))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, got)
+	assert.Equal(t, 3*time.Second, ConstantBackoff{Delay: 3 * time.Second}.NextDelay(7))
+}
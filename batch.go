@@ -0,0 +1,68 @@
+package wsclient
+
+import "time"
+
+// batchDelivery is the configuration set with WithBatchDelivery
+type batchDelivery struct {
+	maxBatch int
+	maxWait  time.Duration
+}
+
+// WithBatchDelivery makes the client pass the messages from the server to
+// OnBatch in batches instead of one by one to OnMessage. A batch is delivered
+// once it holds maxBatch messages, or maxWait after its first message
+// arrived, whichever comes first. It has no effect unless OnBatch is set.
+func WithBatchDelivery(maxBatch int, maxWait time.Duration) Option {
+	return func(c *WSClient) {
+		if maxBatch < 1 {
+			maxBatch = 1
+		}
+		c.batchDelivery = &batchDelivery{maxBatch: maxBatch, maxWait: maxWait}
+	}
+}
+
+// OnBatch is the callback function when a batch of messages is received from
+// the server, see WithBatchDelivery. It is called from a single goroutine, so
+// batches are delivered in order.
+func (c *WSClient) OnBatch(fn func(frames [][]byte)) {
+	c.callbacksMu.Lock()
+	c.cb.onBatch = fn
+	c.callbacksMu.Unlock()
+}
+
+// batchLoop collects the frames received on a connection into batches and
+// passes them to OnBatch, until frames is closed
+func (c *WSClient) batchLoop(frames <-chan []byte) {
+	var batch [][]byte
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) > 0 {
+			c.callbacks().onBatch(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case data, ok := <-frames:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer = time.NewTimer(c.batchDelivery.maxWait)
+				timeout = timer.C
+			}
+			batch = append(batch, data)
+			if len(batch) >= c.batchDelivery.maxBatch {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
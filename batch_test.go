@@ -0,0 +1,63 @@
+package wsclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchDelivery(t *testing.T) {
+	const maxWait = 100 * time.Millisecond
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < 10; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(strconv.Itoa(i)))
+		}
+		conn.ReadMessage()
+	})
+
+	type batch struct {
+		at     time.Time
+		frames []string
+	}
+	batches := make(chan batch, 10)
+	ws := NewWSClient(u, WithBatchDelivery(4, maxWait))
+	ws.OnBatch(func(frames [][]byte) {
+		b := batch{at: time.Now()}
+		for _, f := range frames {
+			b.frames = append(b.frames, string(f))
+		}
+		batches <- b
+	})
+	ws.OnMessage(func(data []byte) {
+		t.Errorf("OnMessage called: %s", data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	want := [][]string{
+		{"0", "1", "2", "3"},
+		{"4", "5", "6", "7"},
+		// the rest is delivered once maxWait passed
+		{"8", "9"},
+	}
+	for i, frames := range want {
+		select {
+		case b := <-batches:
+			assert.Equal(t, frames, b.frames)
+			if i == len(want)-1 {
+				assert.GreaterOrEqual(t, int64(b.at.Sub(start)), int64(maxWait))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for batch %d", i)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package wsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// Buffers that grew larger than this are not returned to the pool, so that a
+// single large message does not pin memory
+const maxPooledBufferSize = 64 * 1024
+
+// encodeBuffer is a pooled buffer with a JSON encoder writing into it
+type encodeBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := new(encodeBuffer)
+		buf.enc = json.NewEncoder(&buf.Buffer)
+		return buf
+	},
+}
+
+// WithPooledBuffers makes SendJSON and SendJSONAck marshal into buffers taken
+// from a shared pool instead of allocating a new slice per message. A buffer
+// goes back to the pool only after writePump has written the message, so
+// this reduces garbage for high-frequency senders without risk of a buffer
+// being reused while it is still queued or being written. Outbound
+// middleware must not retain the slice it is given when this is enabled.
+func WithPooledBuffers() Option {
+	return func(c *WSClient) {
+		c.pooledBuffers = true
+	}
+}
+
+func getBuffer() *encodeBuffer {
+	buf := bufferPool.Get().(*encodeBuffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *encodeBuffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// release returns the pooled buffer backing m, if any. m.data must not be
+// used afterwards.
+func (m *message) release() {
+	if m.buf != nil {
+		putBuffer(m.buf)
+		m.buf = nil
+		m.data = nil
+	}
+}
+
+// WithPooledReadBuffers makes the client read the messages from the server
+// into a buffer reused from one message to the next instead of allocating a
+// new slice per message, for high-throughput consumers. The slices passed to
+// OnMessage, OnTextMessage, OnBinaryMessage, OnUnhandledFrame, the handlers
+// of SetHandlers and the frame tap are then only valid until the callback
+// returns, and must be copied to be kept. The messages handed over to
+// SendAndWait, ReceiveJSON, subscriptions and streams, batches and async
+// handlers are copied, and remain valid.
+func WithPooledReadBuffers() Option {
+	return func(c *WSClient) {
+		c.pooledReads = true
+	}
+}
+
+// readMessage reads the next message from conn, into the buffer of conn
+// with WithPooledReadBuffers
+func (c *WSClient) readMessage(conn *connection) (int, []byte, error) {
+	if !c.pooledReads {
+		return conn.ws.ReadMessage()
+	}
+	mt, r, err := conn.ws.NextReader()
+	if err != nil {
+		return mt, nil, err
+	}
+	if conn.readBuf == nil || conn.readBuf.Cap() > maxPooledBufferSize {
+		// a single large message does not pin memory for the connection
+		conn.readBuf = new(bytes.Buffer)
+	}
+	conn.readBuf.Reset()
+	if _, err := conn.readBuf.ReadFrom(r); err != nil {
+		return mt, nil, err
+	}
+	return mt, conn.readBuf.Bytes(), nil
+}
+
+// retain returns data, received from the server, in a slice that remains
+// valid after the next message is read
+func (c *WSClient) retain(data []byte) []byte {
+	if !c.pooledReads {
+		return data
+	}
+	return append([]byte(nil), data...)
+}
@@ -0,0 +1,188 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPooledBuffers(t *testing.T) {
+	const senders = 4
+	const count = 250
+	done := make(chan bool)
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		next := make(map[int]int)
+		for i := 0; i < senders*count; i++ {
+			_, data, err := conn.ReadMessage()
+			if !assert.NoError(t, err) {
+				break
+			}
+			var m struct {
+				Sender  int    `json:"sender"`
+				Seq     int    `json:"seq"`
+				Payload string `json:"payload"`
+			}
+			if !assert.NoError(t, json.Unmarshal(data, &m), string(data)) {
+				break
+			}
+			assert.Equal(t, next[m.Sender], m.Seq)
+			assert.Equal(t, strings.Repeat("x", m.Seq), m.Payload)
+			next[m.Sender]++
+		}
+		done <- true
+	})
+
+	ws := NewWSClient(u, WithPooledBuffers())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for s := 0; s < senders; s++ {
+		go func(s int) {
+			for i := 0; i < count; i++ {
+				ws.SendJSON(M{"sender": s, "seq": i, "payload": strings.Repeat("x", i)})
+			}
+		}(s)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+}
+
+func benchmarkSendJSON(b *testing.B, opts ...Option) {
+	u := newTestServer(b, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	})
+
+	ws := NewWSClient(u, append(opts, WithLogger(discardLogger{}))...)
+	if err := ws.Dial(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	defer ws.Close()
+
+	msg := M{"type": "quote", "symbol": "ABC", "price": 101.25}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ws.SendJSON(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSendJSON(b *testing.B) {
+	benchmarkSendJSON(b)
+}
+
+func BenchmarkSendJSONPooled(b *testing.B) {
+	benchmarkSendJSON(b, WithPooledBuffers())
+}
+
+func TestPooledReadBuffers(t *testing.T) {
+	payload := func(i int) string {
+		return strings.Repeat(string(rune('a'+i%26)), 1+i*37%500)
+	}
+	const n = 50
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		var req M
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		conn.WriteJSON(M{"id": req["id"], "op": "response"})
+		for i := 0; i < n; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(payload(i)))
+		}
+		conn.ReadMessage()
+	})
+
+	var got []string
+	done := make(chan bool)
+	ws := NewWSClient(u, WithPooledReadBuffers())
+	ws.OnMessage(func(data []byte) {
+		// the data is intact while the callback runs
+		got = append(got, string(data))
+		if len(got) == n {
+			close(done)
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	resp, err := ws.SendAndWait(ctx, M{"op": "request"}, "id")
+	if !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+	for i, data := range got {
+		assert.Equal(t, payload(i), data)
+	}
+	// the response handed over to SendAndWait is not overwritten by the
+	// messages read afterwards
+	assert.JSONEq(t, `{"id":"1","op":"response"}`, string(resp))
+}
+
+func benchmarkReceive(b *testing.B, opts ...Option) {
+	msg := []byte(`{"type":"quote","symbol":"ABC","price":101.25}`)
+	u := newTestServer(b, func(conn *websocket.Conn) {
+		pm, err := websocket.NewPreparedMessage(websocket.TextMessage, msg)
+		if err != nil {
+			return
+		}
+		for i := 0; i < b.N; i++ {
+			if err := conn.WritePreparedMessage(pm); err != nil {
+				return
+			}
+		}
+		conn.ReadMessage()
+	})
+
+	received := make(chan bool, 1)
+	var count int
+	ws := NewWSClient(u, append(opts, WithLogger(discardLogger{}))...)
+	ws.OnMessage(func(data []byte) {
+		count++
+		if count == b.N {
+			received <- true
+		}
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := ws.Dial(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	<-received
+	b.StopTimer()
+	ws.Close()
+}
+
+func BenchmarkReceive(b *testing.B) {
+	benchmarkReceive(b)
+}
+
+func BenchmarkReceivePooled(b *testing.B) {
+	benchmarkReceive(b, WithPooledReadBuffers())
+}
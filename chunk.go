@@ -0,0 +1,59 @@
+package wsclient
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrInvalidChunkSize is returned by SendChunked for a chunk size that is
+// not positive
+var ErrInvalidChunkSize = errors.New("wsclient: invalid chunk size")
+
+// SendChunked sends data to the server as a single message of the given
+// messageType, streamed to the connection in chunks of chunkSize bytes
+// rather than in one write. Each chunk gets its own write deadline, so a
+// large payload does not have to be written within the default 10 seconds
+// as a whole, as long as the connection keeps making progress. The message
+// goes through the writer like any other, so it is never interleaved with
+// other messages.
+//
+// chunkSize does not decide how the message is fragmented: gorilla/websocket
+// cuts a frame whenever its write buffer is full, see WithWriteBufferSize,
+// and the frames do not line up with the chunks.
+func (c *WSClient) SendChunked(messageType int, data []byte, chunkSize int) error {
+	if !isDataMessageType(messageType) {
+		return ErrInvalidMessageType
+	}
+	if chunkSize <= 0 {
+		return ErrInvalidChunkSize
+	}
+	m := c.newMessage(messageType, data)
+	m.chunkSize = chunkSize
+	return c.enqueue(m)
+}
+
+// writeChunked writes a message to ws in chunks of size bytes, each one
+// within writeWait
+func (c *WSClient) writeChunked(ws *websocket.Conn, mt int, data []byte, size int) error {
+	ws.SetWriteDeadline(time.Now().Add(writeWait))
+	w, err := ws.NextWriter(mt)
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		ws.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := w.Write(data[:n]); err != nil {
+			w.Close()
+			return err
+		}
+		data = data[n:]
+	}
+	ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return w.Close()
+}
@@ -0,0 +1,52 @@
+package wsclient
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendChunked(t *testing.T) {
+	type frame struct {
+		mt   int
+		data []byte
+	}
+	received := make(chan frame, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- frame{mt, data}
+		}
+	})
+
+	ws := NewWSClient(u, WithWriteBufferSize(64<<10))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	assert.NoError(t, ws.SendChunked(websocket.BinaryMessage, payload, 64<<10))
+	assert.NoError(t, ws.SendText("next"))
+	for _, want := range []frame{{websocket.BinaryMessage, payload}, {websocket.TextMessage, []byte("next")}} {
+		select {
+		case f := <-received:
+			assert.Equal(t, want.mt, f.mt)
+			assert.True(t, bytes.Equal(want.data, f.data), "got %d bytes", len(f.data))
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+
+	assert.Equal(t, ErrInvalidChunkSize, ws.SendChunked(websocket.BinaryMessage, payload, 0))
+	assert.Equal(t, ErrInvalidMessageType, ws.SendChunked(websocket.PingMessage, payload, 64<<10))
+}
@@ -0,0 +1,172 @@
+package wsclient
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultCloseTimeout = 1 * time.Second
+
+// WithCloseTimeout sets how long Close waits for the server to answer the
+// close frame before closing the network connection (default 1s). With a
+// timeout of 0 the connection is closed without a close handshake.
+func WithCloseTimeout(d time.Duration) Option {
+	return func(c *WSClient) {
+		c.closeTimeout = d
+	}
+}
+
+// closeConn sends a close frame to the server and closes conn once the
+// server answered it, which ends readPump, or the close timeout expired
+func (c *WSClient) closeConn(conn *connection) {
+	c.closeConnCode(conn, websocket.CloseNormalClosure, "")
+}
+
+// closeConnCode is closeConn with code and reason in the close frame
+func (c *WSClient) closeConnCode(conn *connection, code int, reason string) {
+	defer conn.ws.Close()
+	if c.closeTimeout <= 0 || isDone(conn.readDone) {
+		return
+	}
+	deadline := time.Now().Add(c.closeTimeout)
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := conn.ws.WriteControl(websocket.CloseMessage, msg, deadline); err != nil {
+		c.logf("Close: close frame: %s", err.Error())
+		return
+	}
+	select {
+	case <-conn.readDone:
+	case <-time.After(time.Until(deadline)):
+		c.logf("Close: no answer to the close frame within %s", c.closeTimeout)
+	}
+}
+
+// CloseOnSignal closes the client, with the close handshake of Close, when
+// the process receives one of sig, by default os.Interrupt or SIGTERM, e.g.
+// on Ctrl-C in a command line tool. Only the first signal is handled: the
+// handler is uninstalled then, so that a second Ctrl-C terminates the
+// process as usual. The returned function uninstalls the handler before a
+// signal arrived.
+func (c *WSClient) CloseOnSignal(sig ...os.Signal) (cancel func()) {
+	if len(sig) == 0 {
+		sig = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig...)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case s := <-signals:
+			signal.Stop(signals)
+			c.logf("Close: received %s", s)
+			c.Close()
+		case <-stop:
+			signal.Stop(signals)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// ErrDrainTimeout is returned by CloseGracefullyWithCode when messages were
+// still waiting to be written once the drain timeout expired
+var ErrDrainTimeout = errors.New("wsclient: drain timeout")
+
+// CloseGracefullyWithCode closes the client after writing the messages sent
+// so far: it drains the client, see Drain, waits up to drainTimeout for the
+// send buffer and the outbox to be written, then closes it like Close, with
+// code and reason in the close frame, e.g. websocket.CloseGoingAway. The
+// close frame is sent even if drainTimeout expired first, in which case the
+// messages left are dropped and ErrDrainTimeout is returned. While
+// reconnecting, the messages in the send buffer wait for the next
+// connection, within drainTimeout as well. Unlike Close, it returns once
+// the client is torn down, after the close handshake bounded by
+// WithCloseTimeout. It returns ErrClosed if the client is closed already or
+// gets closed in the meantime.
+func (c *WSClient) CloseGracefullyWithCode(code int, reason string, drainTimeout time.Duration) error {
+	if isDone(c.closing()) {
+		return ErrClosed
+	}
+	c.Drain()
+	err := c.flush(drainTimeout)
+	closeDone := c.shutdown(code, reason)
+	if closeDone == nil {
+		return ErrClosed
+	}
+	<-closeDone
+	return err
+}
+
+// flush waits up to timeout for the messages sent so far to be written
+func (c *WSClient) flush(timeout time.Duration) error {
+	if c.unavailable() != nil && c.outboxSize == 0 && !c.buffered() {
+		// nothing is waiting for a writer
+		return nil
+	}
+	// a barrier behind the messages sent so far is acked once they are
+	// written; it waits for sendMu in the background, so that a send
+	// blocked on a full buffer does not hold up the timeout
+	ack := make(chan error, 1)
+	m := &message{barrier: true, ack: ack}
+	c.goroutine(func() {
+		c.sendMu.Lock()
+		defer c.sendMu.Unlock()
+		switch err := c.enqueueBarrier(m); err {
+		case nil:
+		case ErrNotConnected, ErrReconnecting:
+			ack <- nil
+		default:
+			ack <- err
+		}
+	})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-ack:
+		return err
+	case <-timer.C:
+		c.logf("Close: messages not written within %s", timeout)
+		return ErrDrainTimeout
+	}
+}
+
+// buffered reports whether messages are waiting in the send buffer
+func (c *WSClient) buffered() bool {
+	return len(c.send) > 0 || len(c.priority) > 0
+}
+
+// enqueueBarrier queues the barrier m behind the messages sent so far,
+// without the handling of the messages in enqueueLocked, such as the
+// compression filter. sendMu must be held.
+func (c *WSClient) enqueueBarrier(m *message) error {
+	if isDone(c.closing()) {
+		return ErrClosed
+	}
+	c.outboxMu.Lock()
+	if c.offline {
+		// not counted against the outbox size, it is not a message
+		c.outbox = append(c.outbox, m)
+		c.outboxMu.Unlock()
+		return nil
+	}
+	c.outboxMu.Unlock()
+	if err := c.unavailable(); err != nil && !c.buffered() {
+		return err
+	}
+	// behind the messages in the send buffer, which are written once
+	// reconnected or time out the flush
+	select {
+	case c.send <- m:
+		return nil
+	case <-c.closing():
+		return ErrClosed
+	}
+}
@@ -0,0 +1,285 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseHandshake(t *testing.T) {
+	closeErr := make(chan error, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		_, _, err := conn.ReadMessage()
+		closeErr <- err
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	ws.Close()
+
+	select {
+	case err := <-closeErr:
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the close frame")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestCloseTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		// never read, so the close frame is not answered
+		<-release
+	})
+
+	closed := make(chan time.Time, 1)
+	ws := NewWSClient(u, WithCloseTimeout(timeout), WithLogger(discardLogger{}))
+	ws.OnClose(func() {
+		closed <- time.Now()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	start := time.Now()
+	ws.Close()
+
+	select {
+	case at := <-closed:
+		elapsed := at.Sub(start)
+		assert.GreaterOrEqual(t, int64(elapsed), int64(timeout))
+		assert.Less(t, int64(elapsed), int64(defaultCloseTimeout))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not complete")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestCloseOnSignal(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	ws := NewWSClient(u, WithLogger(discardLogger{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	closed := make(chan bool)
+	ws.OnClose(func() {
+		close(closed)
+	})
+
+	stop := ws.CloseOnSignal(os.Interrupt)
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if !assert.NoError(t, err) {
+		return
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot signal the process: %s", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for close")
+	}
+	assert.Equal(t, StateClosed, ws.State())
+}
+
+// newCloseRecorder starts a server passing the messages it receives to
+// received and the error ending the connection, normally a
+// *websocket.CloseError, to closed
+func newCloseRecorder(t *testing.T) (string, chan string, chan error) {
+	received := make(chan string, 10)
+	closed := make(chan error, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			received <- string(data)
+		}
+	})
+	return u, received, closed
+}
+
+func TestCloseGracefullyWithCode(t *testing.T) {
+	u, received, closed := newCloseRecorder(t)
+
+	// pace the writer, so that the messages are still queued when closing
+	var filtered int32
+	ws := NewWSClient(u, WithSendBuffer(5), WithCompression(),
+		WithCompressionFilter(func(mt int, data []byte) bool {
+			// only called for the messages, not for the end of the drain
+			assert.Equal(t, websocket.TextMessage, mt)
+			assert.NotEmpty(t, data)
+			atomic.AddInt32(&filtered, 1)
+			return true
+		}))
+	ws.OnBytesWritten(func(int) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, ws.SendJSON(M{"n": i}))
+	}
+	assert.NoError(t, ws.CloseGracefullyWithCode(4000, "bye", 5*time.Second))
+	assert.Equal(t, StateClosed, ws.State())
+	assert.Equal(t, ErrClosed, ws.SendJSON(M{"n": 5}))
+
+	for i := 0; i < 5; i++ {
+		assert.JSONEq(t, fmt.Sprintf(`{"n":%d}`, i), <-received)
+	}
+	err := <-closed
+	if assert.IsType(t, &websocket.CloseError{}, err) {
+		assert.Equal(t, 4000, err.(*websocket.CloseError).Code)
+		assert.Equal(t, "bye", err.(*websocket.CloseError).Text)
+	}
+	assert.Equal(t, ErrClosed, ws.CloseGracefullyWithCode(4000, "", time.Second))
+	assert.EqualValues(t, 5, atomic.LoadInt32(&filtered))
+	waitShutdown(t, ws)
+}
+
+func TestCloseGracefullyDrainTimeout(t *testing.T) {
+	u, received, closed := newCloseRecorder(t)
+
+	// stall the writer after its first write
+	stalled := make(chan bool)
+	release := make(chan bool)
+	ws := NewWSClient(u, WithSendBuffer(2))
+	ws.OnBytesWritten(func(int) {
+		select {
+		case stalled <- true:
+			<-release
+		default:
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	go ws.SendText("first")
+	<-stalled
+	assert.NoError(t, ws.SendJSON(M{"n": 0}))
+
+	// the close frame is sent although the queued message was not written
+	err := ws.CloseGracefullyWithCode(websocket.CloseGoingAway, "", 50*time.Millisecond)
+	assert.Equal(t, ErrDrainTimeout, err)
+	assert.Equal(t, "first", <-received)
+	err = <-closed
+	if assert.IsType(t, &websocket.CloseError{}, err) {
+		assert.Equal(t, websocket.CloseGoingAway, err.(*websocket.CloseError).Code)
+	}
+	close(release)
+	waitShutdown(t, ws)
+}
+
+func TestCloseGracefullyWhileReconnecting(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		delay time.Duration
+		err   error
+		drops int32
+	}{
+		{"reconnected", 100 * time.Millisecond, nil, 0},
+		{"timeout", 10 * time.Second, ErrDrainTimeout, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var conns int32
+			first := make(chan bool)
+			received := make(chan string, 2)
+			u := newTestServer(t, func(conn *websocket.Conn) {
+				if atomic.AddInt32(&conns, 1) == 1 {
+					conn.ReadMessage()
+					<-first
+					return
+				}
+				for {
+					_, data, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					received <- string(data)
+				}
+			})
+
+			// stall the writer after its first write, so that the next
+			// messages are still in the send buffer when the connection
+			// is lost
+			stalled := make(chan bool)
+			release := make(chan bool)
+			var drops int32
+			ws := NewWSClient(u, WithSendBuffer(2), WithReconnect(ReconnectConfig{
+				InitialDelay: tc.delay,
+			}))
+			ws.OnBytesWritten(func(int) {
+				select {
+				case stalled <- true:
+					<-release
+				default:
+				}
+			})
+			ws.OnDrop(func(data []byte, reason string) {
+				assert.Equal(t, DropClosed, reason)
+				atomic.AddInt32(&drops, 1)
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if !assert.NoError(t, ws.Open(ctx)) {
+				return
+			}
+
+			go ws.SendText("first")
+			<-stalled
+			assert.NoError(t, ws.SendJSON(M{"n": 0}))
+			assert.NoError(t, ws.SendJSON(M{"n": 1}))
+			close(first)
+			assert.NoError(t, ws.WaitState(ctx, StateBackingOff))
+
+			// the buffered messages wait for the next connection
+			err := ws.CloseGracefullyWithCode(websocket.CloseNormalClosure, "", time.Second)
+			assert.Equal(t, tc.err, err)
+			assert.EqualValues(t, tc.drops, atomic.LoadInt32(&drops))
+			if tc.err == nil {
+				for i := 0; i < 2; i++ {
+					select {
+					case data := <-received:
+						assert.JSONEq(t, fmt.Sprintf(`{"n":%d}`, i), data)
+					case <-time.After(time.Second):
+						t.Fatal("timed out waiting for message")
+					}
+				}
+			}
+			close(release)
+			waitShutdown(t, ws)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package wsclient
+
+import (
+	"compress/flate"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Compression levels accepted by SetCompressionLevel, as defined by
+// compress/flate
+const (
+	minCompressionLevel     = -2
+	maxCompressionLevel     = 9
+	defaultCompressionLevel = 1
+)
+
+// ErrInvalidCompressionLevel is returned by SetCompressionLevel for a level
+// outside of the range accepted by compress/flate
+var ErrInvalidCompressionLevel = errors.New("wsclient: invalid compression level")
+
+// WithCompression makes the client offer the permessage-deflate extension in
+// the handshake. If the server accepts it, outbound messages are compressed
+// unless disabled with EnableWriteCompression, and compressed inbound
+// messages are decompressed.
+func WithCompression() Option {
+	return func(c *WSClient) {
+		c.dialer.EnableCompression = true
+	}
+}
+
+// SetCompressionLevel sets the flate compression level, from -2 (Huffman
+// only) to 9 (best compression), used for messages sent from now on. The
+// default is 1 (best speed). It has no effect unless compression was
+// negotiated, see WithCompression. It is safe to call while connected.
+func (c *WSClient) SetCompressionLevel(level int) error {
+	if level < minCompressionLevel || level > maxCompressionLevel {
+		return ErrInvalidCompressionLevel
+	}
+	c.compressionMu.Lock()
+	c.compressionLevel = level
+	c.compressionMu.Unlock()
+	return nil
+}
+
+// EnableWriteCompression enables or disables compression of messages sent from
+// now on. Messages already queued keep the setting that was in effect when
+// they were sent, so compression can be turned off around a single send,
+// e.g. for a binary blob that is already compressed. It has no effect unless
+// compression was negotiated, see WithCompression. It is safe to call while
+// connected.
+func (c *WSClient) EnableWriteCompression(enable bool) {
+	c.compressionMu.Lock()
+	c.writeCompression = enable
+	c.compressionMu.Unlock()
+}
+
+// WithCompressionFilter sets a function deciding for each message whether it
+// is compressed, e.g. to skip binary payloads that are already compressed.
+// It is called with the frame type and payload when the message is sent, and
+// only if compression is enabled, see EnableWriteCompression.
+func WithCompressionFilter(fn func(messageType int, data []byte) bool) Option {
+	return func(c *WSClient) {
+		c.compressionFilter = fn
+	}
+}
+
+func (c *WSClient) compressionSettings() (bool, int) {
+	c.compressionMu.Lock()
+	defer c.compressionMu.Unlock()
+	return c.writeCompression, c.compressionLevel
+}
+
+// OnSentCompressed is the callback function when a message has been written,
+// with the size of its payload and the size of the payload in the frames on
+// the wire, e.g. for bandwidth accounting. The two are equal for a message
+// that was not compressed, e.g. because compression was not negotiated, see
+// WithCompression, or turned off by EnableWriteCompression. Frame headers
+// are not counted. gorilla/websocket does not report the compressed size,
+// so while the callback is set each compressed message is compressed a
+// second time to measure it.
+func (c *WSClient) OnSentCompressed(fn func(original, wireSize int)) {
+	c.callbacksMu.Lock()
+	c.cb.onSentCompressed = fn
+	c.callbacksMu.Unlock()
+}
+
+// negotiatedCompression tells whether the server accepted the
+// permessage-deflate extension with the response header
+func (c *WSClient) negotiatedCompression(header http.Header) bool {
+	if !c.dialer.EnableCompression {
+		return false
+	}
+	for _, ext := range header.Values("Sec-WebSocket-Extensions") {
+		if strings.Contains(ext, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+// flateWriters pools the writers of compressedSize, one pool per level
+var flateWriters [maxCompressionLevel - minCompressionLevel + 1]sync.Pool
+
+// compressedSize returns the size of the payload of m, written to conn, in
+// the frames on the wire
+func compressedSize(conn *connection, m *message) int {
+	if !conn.deflate || !m.compress {
+		return len(m.data)
+	}
+	// gorilla/websocket compresses every message on its own and strips the
+	// trailing 4 bytes of the final flush, so compressing it again gives
+	// the size that was written
+	var n countingWriter
+	pool := &flateWriters[m.compressionLevel-minCompressionLevel]
+	fw, _ := pool.Get().(*flate.Writer)
+	if fw == nil {
+		var err error
+		if fw, err = flate.NewWriter(&n, m.compressionLevel); err != nil {
+			return len(m.data)
+		}
+	} else {
+		fw.Reset(&n)
+	}
+	fw.Write(m.data)
+	fw.Flush()
+	// not to keep n alive
+	fw.Reset(nil)
+	pool.Put(fw)
+	return int(n) - 4
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter int
+
+func (n *countingWriter) Write(p []byte) (int, error) {
+	*n += countingWriter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,222 @@
+package wsclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingListener counts the bytes read from all accepted connections
+type countingListener struct {
+	net.Listener
+	n int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, n: &l.n}, nil
+}
+
+func (l *countingListener) Count() int64 {
+	return atomic.LoadInt64(&l.n)
+}
+
+type countingConn struct {
+	net.Conn
+	n *int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// newCompressionServer starts a server that negotiates compression and
+// passes every received message to received. It returns the ws:// URL and
+// the listener counting the bytes received on the wire.
+func newCompressionServer(t *testing.T, received chan<- []byte) (string, *countingListener) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- data
+		}
+	}))
+	l := &countingListener{Listener: s.Listener}
+	s.Listener = l
+	s.Start()
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http"), l
+}
+
+func TestEnableWriteCompression(t *testing.T) {
+	received := make(chan []byte, 1)
+	u, l := newCompressionServer(t, received)
+
+	ws := NewWSClient(u, WithCompression())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	payload := strings.Repeat("a", 10000)
+	wireSize := func(send func()) int64 {
+		before := l.Count()
+		send()
+		select {
+		case data := <-received:
+			assert.Equal(t, payload, string(data))
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+		return l.Count() - before
+	}
+
+	compressed := wireSize(func() {
+		ws.SendText(payload)
+	})
+	uncompressed := wireSize(func() {
+		ws.EnableWriteCompression(false)
+		ws.SendText(payload)
+		ws.EnableWriteCompression(true)
+	})
+	assert.True(t, compressed < 1000, "compressed message took %d bytes", compressed)
+	assert.True(t, uncompressed >= int64(len(payload)), "uncompressed message took %d bytes", uncompressed)
+
+	again := wireSize(func() {
+		ws.SendText(payload)
+	})
+	assert.True(t, again < 1000, "compressed message took %d bytes", again)
+}
+
+func TestCompressionFilter(t *testing.T) {
+	received := make(chan []byte, 1)
+	u, l := newCompressionServer(t, received)
+
+	ws := NewWSClient(u, WithCompression(), WithCompressionFilter(func(mt int, data []byte) bool {
+		return mt == websocket.TextMessage
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// the same compressible payload is only compressed as a text frame
+	payload := strings.Repeat("a", 10000)
+	wireSize := func(mt int) int64 {
+		before := l.Count()
+		assert.NoError(t, ws.SendRaw(mt, []byte(payload)))
+		select {
+		case data := <-received:
+			assert.Equal(t, payload, string(data))
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+		return l.Count() - before
+	}
+
+	text := wireSize(websocket.TextMessage)
+	binary := wireSize(websocket.BinaryMessage)
+	assert.True(t, text < 1000, "text message took %d bytes", text)
+	assert.True(t, binary >= int64(len(payload)), "binary message took %d bytes", binary)
+}
+
+func TestSetCompressionLevel(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	assert.NoError(t, ws.SetCompressionLevel(9))
+	assert.NoError(t, ws.SetCompressionLevel(-2))
+	assert.Equal(t, ErrInvalidCompressionLevel, ws.SetCompressionLevel(10))
+	assert.Equal(t, ErrInvalidCompressionLevel, ws.SetCompressionLevel(-3))
+}
+
+func TestOnSentCompressed(t *testing.T) {
+	received := make(chan []byte, 1)
+	u, l := newCompressionServer(t, received)
+
+	type sizes struct{ original, wire int }
+	sent := make(chan sizes, 1)
+	ws := NewWSClient(u, WithCompression())
+	ws.OnSentCompressed(func(original, wireSize int) {
+		sent <- sizes{original, wireSize}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	payload := strings.Repeat("abc", 5000)
+	send := func() (sizes, int64) {
+		before := l.Count()
+		assert.NoError(t, ws.SendText(payload))
+		<-received
+		return <-sent, l.Count() - before
+	}
+
+	s, onWire := send()
+	assert.Equal(t, len(payload), s.original)
+	assert.True(t, s.wire < s.original/10, "compressed to %d bytes", s.wire)
+	// the frame headers, with the masking key, come on top
+	assert.True(t, onWire > int64(s.wire) && onWire <= int64(s.wire)+14, "%d bytes on the wire for %d", onWire, s.wire)
+	again, _ := send()
+	assert.Equal(t, s, again)
+
+	ws.EnableWriteCompression(false)
+	s, _ = send()
+	assert.Equal(t, sizes{len(payload), len(payload)}, s)
+}
+
+func TestOnSentCompressedNotNegotiated(t *testing.T) {
+	received := make(chan []byte, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- data
+		}
+	})
+
+	sent := make(chan [2]int, 1)
+	ws := NewWSClient(u, WithCompression())
+	ws.OnSentCompressed(func(original, wireSize int) {
+		sent <- [2]int{original, wireSize}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	payload := strings.Repeat("abc", 5000)
+	assert.NoError(t, ws.SendText(payload))
+	<-received
+	assert.Equal(t, [2]int{len(payload), len(payload)}, <-sent)
+}
@@ -0,0 +1,83 @@
+package wsclient
+
+import "time"
+
+// defaultBufferSize is the size gorilla/websocket gives the read and write
+// buffers when none is set
+const defaultBufferSize = 4096
+
+// Config is a snapshot of the resolved configuration of a client, as set
+// by the options passed to NewWSClient, with the defaults filled in for the
+// options that were not. It is meant for diagnostics.
+type Config struct {
+	Name string
+	// MessageType is the frame type of the JSON messages sent
+	MessageType int
+	// ReadLimit is the maximum size of a message read, 0 for no limit
+	ReadLimit       int64
+	ReadBufferSize  int
+	WriteBufferSize int
+	// HandshakeTimeout is the time allowed for the handshake, 0 for no
+	// limit other than the context of the dial
+	HandshakeTimeout time.Duration
+	// MaxRedirects is the number of handshake redirects followed
+	MaxRedirects int
+	// Compression tells whether compression is offered to the server
+	Compression      bool
+	CompressionLevel int
+	WriteCompression bool
+	// PingInterval is the interval of the keepalive pings, 0 for none
+	PingInterval time.Duration
+	// ReadTimeout is the sliding read timeout, 0 for none
+	ReadTimeout time.Duration
+	// TCPKeepAlive is the TCP keepalive period, 0 when not set
+	TCPKeepAlive time.Duration
+	CloseTimeout time.Duration
+	OutboxSize   int
+	SendBuffer   int
+	// Reconnect is the reconnection policy, nil without reconnection
+	Reconnect          *ReconnectConfig
+	ExpectedCloseCodes []int
+	TypeField          string
+	TopicField         string
+	StreamField        string
+}
+
+// Config returns the resolved configuration of the client. Changing the
+// returned value has no effect on the client.
+func (c *WSClient) Config() Config {
+	compress, level := c.compressionSettings()
+	cfg := Config{
+		Name:               c.name,
+		MessageType:        c.messageType,
+		ReadLimit:          c.readLimit,
+		ReadBufferSize:     c.dialer.ReadBufferSize,
+		WriteBufferSize:    c.dialer.WriteBufferSize,
+		HandshakeTimeout:   c.dialer.HandshakeTimeout,
+		MaxRedirects:       c.maxRedirects,
+		Compression:        c.dialer.EnableCompression,
+		CompressionLevel:   level,
+		WriteCompression:   compress,
+		PingInterval:       c.pingInterval,
+		ReadTimeout:        c.readTimeout,
+		TCPKeepAlive:       c.tcpKeepAlive,
+		CloseTimeout:       c.closeTimeout,
+		OutboxSize:         c.outboxSize,
+		SendBuffer:         cap(c.send),
+		ExpectedCloseCodes: append([]int(nil), c.expectedCloseCodes...),
+		TypeField:          c.typeField,
+		TopicField:         c.topicField,
+		StreamField:        c.streamField,
+	}
+	if cfg.ReadBufferSize == 0 {
+		cfg.ReadBufferSize = defaultBufferSize
+	}
+	if cfg.WriteBufferSize == 0 {
+		cfg.WriteBufferSize = defaultBufferSize
+	}
+	if c.reconnect != nil {
+		reconnect := *c.reconnect
+		cfg.Reconnect = &reconnect
+	}
+	return cfg
+}
@@ -0,0 +1,50 @@
+package wsclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082/feed",
+		WithReadLimit(1<<20),
+		WithWriteBufferSize(1<<16),
+		WithCompression(),
+		WithPingInterval(30*time.Second),
+		WithReconnect(ReconnectConfig{MaxAttempts: 3}),
+		WithExpectedCloseCodes(websocket.CloseGoingAway))
+	assert.NoError(t, ws.SetCompressionLevel(6))
+
+	cfg := ws.Config()
+	assert.Equal(t, Config{
+		Name:             "localhost:8082",
+		MessageType:      websocket.TextMessage,
+		ReadLimit:        1 << 20,
+		ReadBufferSize:   4096,
+		WriteBufferSize:  1 << 16,
+		HandshakeTimeout: 45 * time.Second,
+		Compression:      true,
+		CompressionLevel: 6,
+		WriteCompression: true,
+		PingInterval:     30 * time.Second,
+		CloseTimeout:     time.Second,
+		Reconnect: &ReconnectConfig{
+			InitialDelay: time.Second,
+			MaxDelay:     30 * time.Second,
+			MaxAttempts:  3,
+		},
+		ExpectedCloseCodes: []int{websocket.CloseNormalClosure, websocket.CloseGoingAway},
+		TypeField:          "type",
+		TopicField:         "topic",
+		StreamField:        "stream",
+	}, cfg)
+
+	// the snapshot is a copy
+	cfg.Reconnect.MaxAttempts = 10
+	cfg.ExpectedCloseCodes[0] = websocket.CloseAbnormalClosure
+	assert.Equal(t, 3, ws.Config().Reconnect.MaxAttempts)
+	assert.Equal(t, websocket.CloseNormalClosure, ws.Config().ExpectedCloseCodes[0])
+}
@@ -0,0 +1,27 @@
+package wsclient
+
+import "bytes"
+
+// WithDedupConsecutiveSends makes the client skip a message identical to the
+// previous one written to the connection, same frame type and same bytes,
+// e.g. for a client that recomputes and resends its whole state. The
+// skipped message counts as written: SendJSONAck reports nil for it. The
+// first message on each new connection is always written.
+func WithDedupConsecutiveSends() Option {
+	return func(c *WSClient) {
+		c.dedupSends = true
+	}
+}
+
+// isLastSent tells whether m is identical to the last message written to
+// conn
+func (conn *connection) isLastSent(m *message) bool {
+	return conn.hasLastSent && conn.lastSentType == m.mt && bytes.Equal(conn.lastSent, m.data)
+}
+
+// rememberSent records m as the last message written to conn
+func (conn *connection) rememberSent(m *message) {
+	conn.hasLastSent = true
+	conn.lastSentType = m.mt
+	conn.lastSent = append(conn.lastSent[:0], m.data...)
+}
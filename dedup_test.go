@@ -0,0 +1,65 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupConsecutiveSends(t *testing.T) {
+	var conns int32
+	received := make(chan string, 8)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		n := atomic.AddInt32(&conns, 1)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- fmt.Sprintf("%d:%s", n, data)
+		}
+	})
+
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithDedupConsecutiveSends())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	state := M{"x": 1}
+	assert.NoError(t, ws.SendJSON(state))
+	ack, err := ws.SendJSONAck(state)
+	if assert.NoError(t, err) {
+		assert.NoError(t, <-ack)
+	}
+	assert.NoError(t, ws.SendBinary([]byte(`{"x":1}`)))
+	assert.NoError(t, ws.SendJSON(M{"x": 2}))
+	assert.NoError(t, ws.SendJSON(state))
+
+	// after reconnecting the same state is sent again
+	assert.NoError(t, ws.Reconnect())
+	assert.NoError(t, ws.SendJSON(state))
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		select {
+		case data := <-received:
+			got = append(got, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+	assert.Equal(t, []string{`1:{"x":1}`, `1:{"x":1}`, `1:{"x":2}`, `1:{"x":1}`, `2:{"x":1}`}, got)
+	select {
+	case data := <-received:
+		t.Fatalf("unexpected message %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
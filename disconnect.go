@@ -0,0 +1,81 @@
+package wsclient
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DisconnectInfo summarizes a connection once it ended, see OnDisconnect
+type DisconnectInfo struct {
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+	Duration       time.Duration
+
+	// BytesSent and BytesReceived count the payload bytes of the data
+	// frames, MessagesSent and MessagesReceived the frames themselves
+	BytesSent        int64
+	BytesReceived    int64
+	MessagesSent     int64
+	MessagesReceived int64
+
+	// CloseCode is the close code of the connection, 0 if it did not end
+	// with a close frame or an abnormal closure
+	CloseCode int
+	// Err is the reason the connection ended, nil if it was closed by
+	// calling Close
+	Err error
+	// UserInitiated is true if the connection ended because Close was called
+	UserInitiated bool
+}
+
+// OnDisconnect is the callback function when a connection ends, whether it is
+// lost or closed by calling Close. With reconnection enabled it is called
+// once for every connection.
+func (c *WSClient) OnDisconnect(fn func(info DisconnectInfo)) {
+	c.callbacksMu.Lock()
+	c.cb.onDisconnect = fn
+	c.callbacksMu.Unlock()
+}
+
+// connStats are the traffic counters of a connection
+type connStats struct {
+	bytesSent        int64
+	bytesReceived    int64
+	messagesSent     int64
+	messagesReceived int64
+	droppedMessages  int64
+}
+
+func (s *connStats) add(dir Direction, n int) {
+	if dir == Inbound {
+		atomic.AddInt64(&s.messagesReceived, 1)
+		atomic.AddInt64(&s.bytesReceived, int64(n))
+		return
+	}
+	atomic.AddInt64(&s.messagesSent, 1)
+	atomic.AddInt64(&s.bytesSent, int64(n))
+}
+
+// disconnectInfo builds the DisconnectInfo of conn, which just ended
+func (conn *connection) disconnectInfo() DisconnectInfo {
+	now := time.Now()
+	info := DisconnectInfo{
+		ConnectedAt:      conn.connectedAt,
+		DisconnectedAt:   now,
+		Duration:         now.Sub(conn.connectedAt),
+		BytesSent:        atomic.LoadInt64(&conn.stats.bytesSent),
+		BytesReceived:    atomic.LoadInt64(&conn.stats.bytesReceived),
+		MessagesSent:     atomic.LoadInt64(&conn.stats.messagesSent),
+		MessagesReceived: atomic.LoadInt64(&conn.stats.messagesReceived),
+		UserInitiated:    isDone(conn.closing),
+	}
+	if !info.UserInitiated {
+		info.Err = conn.reason()
+	}
+	if ce, ok := conn.reason().(*websocket.CloseError); ok {
+		info.CloseCode = ce.Code
+	}
+	return info
+}
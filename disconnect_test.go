@@ -0,0 +1,161 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnDisconnect(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, append(data, data...))
+		}
+	})
+
+	echoed := make(chan bool)
+	disconnected := make(chan DisconnectInfo, 1)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		echoed <- true
+	})
+	ws.OnDisconnect(func(info DisconnectInfo) {
+		disconnected <- info
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	for _, text := range []string{"hello", "world!"} {
+		assert.NoError(t, ws.SendText(text))
+		select {
+		case <-echoed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for echo")
+		}
+	}
+	ws.Close()
+
+	select {
+	case info := <-disconnected:
+		assert.False(t, info.ConnectedAt.Before(start))
+		assert.True(t, info.DisconnectedAt.After(info.ConnectedAt))
+		assert.Equal(t, info.DisconnectedAt.Sub(info.ConnectedAt), info.Duration)
+		assert.EqualValues(t, 2, info.MessagesSent)
+		assert.EqualValues(t, 2, info.MessagesReceived)
+		assert.EqualValues(t, 11, info.BytesSent)
+		assert.EqualValues(t, 22, info.BytesReceived)
+		assert.True(t, info.UserInitiated)
+		assert.NoError(t, info.Err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnDisconnect")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestOnDisconnectServerClose(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+		conn.ReadMessage()
+	})
+
+	disconnected := make(chan DisconnectInfo, 1)
+	ws := NewWSClient(u)
+	ws.OnDisconnect(func(info DisconnectInfo) {
+		disconnected <- info
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	select {
+	case info := <-disconnected:
+		assert.False(t, info.UserInitiated)
+		assert.Equal(t, websocket.CloseGoingAway, info.CloseCode)
+		assert.Error(t, info.Err)
+		assert.Zero(t, info.MessagesReceived)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnDisconnect")
+	}
+	waitShutdown(t, ws)
+}
+
+// failingConn fails the writes once fail is set
+type failingConn struct {
+	net.Conn
+	fail *int32
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(c.fail) != 0 {
+		return 0, errors.New("write failed")
+	}
+	return c.Conn.Write(b)
+}
+
+func TestDisconnectWhileHandlerSends(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		<-release
+	})
+
+	var fail int32
+	ws := NewWSClient(u, WithLogger(discardLogger{}),
+		WithNetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &failingConn{Conn: conn, fail: &fail}, nil
+		}))
+	sent := make(chan error, 1)
+	ws.OnMessage(func(data []byte) {
+		atomic.StoreInt32(&fail, 1)
+		// the writer fails on the first message and exits, the second one
+		// waits for a writer that is not coming
+		ws.SendText("first")
+		sent <- ws.SendText("second")
+	})
+	closed := make(chan bool, 1)
+	ws.OnClose(func() {
+		closed <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	select {
+	case err := <-sent:
+		assert.Equal(t, ErrClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the send to fail")
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for close")
+	}
+	assert.Equal(t, StateClosed, ws.State())
+	waitShutdown(t, ws)
+}
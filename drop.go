@@ -0,0 +1,58 @@
+package wsclient
+
+import "sync/atomic"
+
+// Reasons passed to OnDrop
+const (
+	// DropBufferFull is the reason of a FireJSON message dropped because the
+	// writer was busy and the send buffer or the outbox full
+	DropBufferFull = "buffer full"
+	// DropDisconnected is the reason of a FireJSON message dropped because
+	// the client was not connected
+	DropDisconnected = "disconnected"
+	// DropDraining is the reason of a FireJSON message dropped after Drain
+	DropDraining = "draining"
+	// DropDuplicate is the reason of a message skipped by
+	// WithDedupConsecutiveSends
+	DropDuplicate = "duplicate"
+	// DropClosed is the reason of a message still waiting in the send buffer
+	// or the outbox when the client was closed
+	DropClosed = "closed"
+)
+
+// OnDrop is the callback function when a message that was accepted for
+// sending is not going to be written, with its payload and the reason, one
+// of the Drop constants. Messages whose send returned an error are not
+// reported: the caller knows about those already. The drops are counted in
+// Stats.DroppedMessages whether OnDrop is set or not. data is only valid
+// during the callback.
+func (c *WSClient) OnDrop(fn func(data []byte, reason string)) {
+	c.callbacksMu.Lock()
+	c.cb.onDrop = fn
+	c.callbacksMu.Unlock()
+}
+
+// drop accounts for a message dropped for reason
+func (c *WSClient) drop(data []byte, reason string) {
+	c.statsMu.RLock()
+	atomic.AddInt64(&c.stats.droppedMessages, 1)
+	c.statsMu.RUnlock()
+	c.logf("dropped message: %s", reason)
+	if fn := c.callbacks().onDrop; fn != nil {
+		fn(data, reason)
+	}
+}
+
+// dropReason returns the reason for dropping a message that could not be
+// enqueued with err
+func dropReason(err error) string {
+	switch err {
+	case errBusy, ErrOutboxFull:
+		return DropBufferFull
+	case ErrDraining:
+		return DropDraining
+	case ErrClosed:
+		return DropClosed
+	}
+	return DropDisconnected
+}
@@ -0,0 +1,118 @@
+package wsclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnDrop(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	// stall the writer after its first write
+	stalled := make(chan bool)
+	release := make(chan bool)
+	ws := NewWSClient(u, WithSendBuffer(1))
+	ws.OnBytesWritten(func(int) {
+		select {
+		case stalled <- true:
+			<-release
+		default:
+		}
+	})
+	var mu sync.Mutex
+	var dropped []string
+	ws.OnDrop(func(data []byte, reason string) {
+		mu.Lock()
+		dropped = append(dropped, string(data)+" "+reason)
+		mu.Unlock()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	go ws.SendText("first")
+	<-stalled
+	// the buffer holds one message, the newest ones are dropped
+	for i := 0; i < 3; i++ {
+		ws.FireJSON(M{"n": i})
+	}
+	close(release)
+	assert.Eventually(t, func() bool {
+		return ws.QueueDepth() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	ws.Close()
+	waitShutdown(t, ws)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		`{"n":1} buffer full`,
+		`{"n":2} buffer full`,
+	}, dropped)
+	assert.Equal(t, int64(len(dropped)), ws.Stats().DroppedMessages)
+}
+
+func TestOnDropClosed(t *testing.T) {
+	var dropped []string
+	ws := NewWSClient("ws://localhost:8082", WithOutbox(1))
+	ws.OnDrop(func(data []byte, reason string) {
+		dropped = append(dropped, string(data)+" "+reason)
+	})
+	ws.FireJSON(M{"n": 0})
+	ws.FireJSON(M{"n": 1})
+	// the queued message is dropped on Close
+	ws.Close()
+	waitShutdown(t, ws)
+
+	assert.Equal(t, []string{
+		`{"n":1} buffer full`,
+		`{"n":0} closed`,
+	}, dropped)
+	assert.Equal(t, int64(2), ws.Stats().DroppedMessages)
+}
+
+func TestOnDropDuplicate(t *testing.T) {
+	received := make(chan string, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	dropped := make(chan string, 1)
+	ws := NewWSClient(u, WithDedupConsecutiveSends())
+	ws.OnDrop(func(data []byte, reason string) {
+		dropped <- string(data) + " " + reason
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendText("a"))
+	assert.NoError(t, ws.SendText("a"))
+	assert.NoError(t, ws.SendText("b"))
+	assert.Equal(t, "a", <-received)
+	assert.Equal(t, "b", <-received)
+	assert.Equal(t, "a duplicate", <-dropped)
+	assert.Equal(t, int64(1), ws.Stats().DroppedMessages)
+}
@@ -0,0 +1,146 @@
+package wsclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrorKind classifies the errors that end a connection, see ConnError
+type ErrorKind int
+
+const (
+	// ErrorKindNetwork is an error of the underlying network connection
+	ErrorKindNetwork ErrorKind = iota
+	// ErrorKindClose is a close frame received from the server, or the
+	// connection dropped without one (close code 1006). The wrapped error
+	// is a *websocket.CloseError.
+	ErrorKindClose
+	// ErrorKindReadLimit is a message from the server larger than the limit
+	// set with WithReadLimit
+	ErrorKindReadLimit
+	// ErrorKindProtocol is a violation of the WebSocket protocol by the
+	// server, such as a malformed frame
+	ErrorKindProtocol
+)
+
+// String returns the name of the kind
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindNetwork:
+		return "network"
+	case ErrorKindClose:
+		return "close"
+	case ErrorKindReadLimit:
+		return "read limit"
+	case ErrorKindProtocol:
+		return "protocol"
+	}
+	return "unknown"
+}
+
+// ConnError is the error passed to OnError when the connection to the server
+// fails while reading from it. Use errors.As to get at it, or at the wrapped
+// *websocket.CloseError: websocket.IsCloseError does not unwrap errors.
+type ConnError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// HandshakeError is returned by Open, and passed to OnError and OnGiveUp,
+// when the server answers the handshake with an HTTP status instead of
+// switching protocols, e.g. 401 or 503. It wraps websocket.ErrBadHandshake.
+type HandshakeError struct {
+	// StatusCode is the status of the response to the handshake
+	StatusCode int
+	// Header is the header of the response, e.g. with Retry-After
+	Header http.Header
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("%s: status %d", websocket.ErrBadHandshake, e.StatusCode)
+}
+
+// Unwrap returns websocket.ErrBadHandshake
+func (e *HandshakeError) Unwrap() error {
+	return websocket.ErrBadHandshake
+}
+
+// handshakeError wraps err, the error of a dial answered with resp, in a
+// HandshakeError if the server refused the handshake
+func handshakeError(resp *http.Response, err error) error {
+	if err != websocket.ErrBadHandshake || resp == nil {
+		return err
+	}
+	return &HandshakeError{StatusCode: resp.StatusCode, Header: resp.Header}
+}
+
+// IsReadLimitError reports whether err is caused by a message larger than
+// the limit set with WithReadLimit
+func IsReadLimitError(err error) bool {
+	return errors.Is(err, websocket.ErrReadLimit)
+}
+
+// IsProtocolError reports whether err is caused by the server violating the
+// WebSocket protocol
+func IsProtocolError(err error) bool {
+	var ce *ConnError
+	if errors.As(err, &ce) {
+		return ce.Kind == ErrorKindProtocol
+	}
+	return isProtocolError(err)
+}
+
+// protocolErrors are the prefixes of the messages of the errors returned by
+// gorilla/websocket for protocol violations, which have no distinct type
+var protocolErrors = []string{
+	"websocket: RSV",
+	"websocket: len > 125 for control",
+	"websocket: FIN not set on control",
+	"websocket: data before FIN",
+	"websocket: continuation after FIN",
+	"websocket: bad opcode",
+	"websocket: bad MASK",
+	"websocket: bad close code",
+	"websocket: invalid utf8 payload in close frame",
+}
+
+func isProtocolError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, prefix := range protocolErrors {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError wraps an error returned while reading from the connection in
+// a ConnError
+func classifyError(err error) *ConnError {
+	kind := ErrorKindNetwork
+	switch {
+	case isCloseError(err):
+		kind = ErrorKindClose
+	case err == websocket.ErrReadLimit:
+		kind = ErrorKindReadLimit
+	case isProtocolError(err):
+		kind = ErrorKindProtocol
+	}
+	return &ConnError{Kind: kind, Err: err}
+}
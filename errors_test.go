@@ -0,0 +1,128 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnError(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		send  func(conn *websocket.Conn)
+		kind  ErrorKind
+		check func(err error) bool
+	}{
+		{
+			name: "read limit",
+			send: func(conn *websocket.Conn) {
+				conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 2048)))
+			},
+			kind:  ErrorKindReadLimit,
+			check: IsReadLimitError,
+		},
+		{
+			name: "protocol",
+			send: func(conn *websocket.Conn) {
+				// a text frame with the reserved RSV2 bit set
+				conn.UnderlyingConn().Write([]byte{0xa1, 0x00})
+			},
+			kind:  ErrorKindProtocol,
+			check: IsProtocolError,
+		},
+		{
+			name: "close",
+			send: func(conn *websocket.Conn) {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseInternalServerErr, ""))
+			},
+			kind: ErrorKindClose,
+			check: func(err error) bool {
+				var ce *websocket.CloseError
+				return errors.As(err, &ce) && ce.Code == websocket.CloseInternalServerErr
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u := newTestServer(t, func(conn *websocket.Conn) {
+				tc.send(conn)
+				conn.ReadMessage()
+			})
+
+			errs := make(chan error, 1)
+			ws := NewWSClient(u, WithReadLimit(1024), WithLogger(discardLogger{}))
+			ws.OnError(func(err error) {
+				errs <- err
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if !assert.NoError(t, ws.Open(ctx)) {
+				return
+			}
+			defer waitShutdown(t, ws)
+			defer ws.Close()
+
+			select {
+			case err := <-errs:
+				var ce *ConnError
+				if assert.True(t, errors.As(err, &ce)) {
+					assert.Equal(t, tc.kind, ce.Kind)
+				}
+				assert.True(t, tc.check(err))
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for OnError")
+			}
+		})
+	}
+}
+
+func TestExpectedCloseCodes(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "restarting"))
+		conn.ReadMessage()
+	})
+
+	for _, expected := range []bool{false, true} {
+		logger := &captureLogger{}
+		opts := []Option{WithLogger(logger)}
+		if expected {
+			opts = append(opts, WithExpectedCloseCodes(websocket.CloseGoingAway))
+		}
+		errs := make(chan error, 1)
+		closed := make(chan bool)
+		ws := NewWSClient(u, opts...)
+		ws.OnError(func(err error) {
+			errs <- err
+		})
+		ws.OnClose(func() {
+			close(closed)
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if !assert.NoError(t, ws.Open(ctx)) {
+			cancel()
+			return
+		}
+		cancel()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for OnClose")
+		}
+		waitShutdown(t, ws)
+
+		if expected {
+			assert.Empty(t, errs)
+			for _, line := range logger.Lines() {
+				assert.NotContains(t, line, "Read error")
+			}
+		} else {
+			assert.Len(t, errs, 1)
+		}
+	}
+}
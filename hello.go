@@ -0,0 +1,36 @@
+package wsclient
+
+// WithHello makes the client send hello as the first message on every
+// connection, the initial one and each reconnection, e.g. for servers that
+// expect a version announcement. It is written before any other message,
+// including those sent from OnOpen, those queued in the outbox and those
+// resent by WithReliableDelivery. The send enricher applies to it; it is
+// not numbered by WithReliableDelivery.
+func WithHello(hello M) Option {
+	return func(c *WSClient) {
+		c.hello = hello
+	}
+}
+
+// writeHello writes the hello message to conn
+func (c *WSClient) writeHello(conn *connection) error {
+	j := c.hello
+	if c.sendEnricher != nil {
+		// the enricher may add fields, the configured message must not
+		// grow with them
+		copied := make(M, len(j))
+		for k, v := range j {
+			copied[k] = v
+		}
+		j = c.sendEnricher(copied)
+	}
+	m, err := c.encodeJSON(c.messageType, j)
+	if err != nil {
+		return err
+	}
+	m.compress, m.compressionLevel = c.compressionSettings()
+	if m.compress && c.compressionFilter != nil {
+		m.compress = c.compressionFilter(m.mt, m.data)
+	}
+	return c.writeMessage(conn, m)
+}
@@ -0,0 +1,62 @@
+package wsclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHello(t *testing.T) {
+	var conns int32
+	first := make(chan string, 2)
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		n := atomic.AddInt32(&conns, 1)
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		first <- string(data)
+		if n > 1 {
+			<-release
+		}
+		// drop the first connection after its hello
+	})
+
+	reconnected := make(chan bool)
+	ws := NewWSClient(u,
+		WithLogger(discardLogger{}),
+		WithHello(M{"hello": "v2"}),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond}))
+	ws.OnOpen(func() {
+		ws.SendJSON(M{"op": "subscribe"})
+	})
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-first:
+			assert.Equal(t, `{"hello":"v2"}`, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the hello")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package wsclient
+
+import (
+	"sync"
+	"time"
+)
+
+// Direction tells whether a frame was received from or sent to the server
+type Direction int
+
+const (
+	// Inbound is the direction of frames received from the server
+	Inbound Direction = iota
+	// Outbound is the direction of frames sent to the server
+	Outbound
+)
+
+// String returns the name of the direction
+func (d Direction) String() string {
+	switch d {
+	case Inbound:
+		return "inbound"
+	case Outbound:
+		return "outbound"
+	}
+	return "unknown"
+}
+
+// HistoryEntry is a frame recorded in the message history, see WithHistory
+type HistoryEntry struct {
+	Time        time.Time
+	Direction   Direction
+	MessageType int
+	Data        []byte
+}
+
+// history is a ring buffer of the most recent frames
+type history struct {
+	entries []HistoryEntry
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+// WithHistory keeps the last n data frames sent and received, in both
+// directions combined, for post-mortem debugging. They are returned by
+// History.
+func WithHistory(n int) Option {
+	return func(c *WSClient) {
+		if n <= 0 {
+			c.history = nil
+			return
+		}
+		c.history = &history{entries: make([]HistoryEntry, n)}
+	}
+}
+
+// WithFrameTap passes every data frame received from or written to the
+// server to fn, with its direction and type, e.g. to print the traffic while
+// debugging the protocol. Control frames are not passed. fn is called from
+// the goroutines reading and writing the connection, before the frame is
+// handled for an inbound frame and once it was written for an outbound one,
+// so it must return quickly. data is only valid during the call: fn must
+// not modify it and must copy it to keep it.
+func WithFrameTap(fn func(dir Direction, messageType int, data []byte)) Option {
+	return func(c *WSClient) {
+		c.frameTap = fn
+	}
+}
+
+// History returns the frames recorded with WithHistory, oldest first. It
+// returns nil if the history is not enabled.
+func (c *WSClient) History() []HistoryEntry {
+	if c.history == nil {
+		return nil
+	}
+	h := c.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]HistoryEntry(nil), h.entries[:h.next]...)
+	}
+	entries := make([]HistoryEntry, 0, len(h.entries))
+	entries = append(entries, h.entries[h.next:]...)
+	return append(entries, h.entries[:h.next]...)
+}
+
+func (h *history) add(dir Direction, mt int, data []byte) {
+	e := HistoryEntry{
+		Time:        time.Now(),
+		Direction:   dir,
+		MessageType: mt,
+		Data:        append([]byte(nil), data...),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries[h.next] = e
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+}
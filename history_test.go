@@ -0,0 +1,111 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, append([]byte("re:"), data...))
+		}
+	})
+
+	echoed := make(chan bool)
+	ws := NewWSClient(u, WithHistory(4))
+	ws.OnMessage(func(data []byte) {
+		echoed <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.Empty(t, ws.History())
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ws.SendText(fmt.Sprint(i)))
+		select {
+		case <-echoed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for echo")
+		}
+	}
+
+	// only the last 4 of the 6 frames are kept, oldest first
+	type frame struct {
+		dir  Direction
+		data string
+	}
+	var got []frame
+	history := ws.History()
+	for i, e := range history {
+		got = append(got, frame{e.Direction, string(e.Data)})
+		assert.Equal(t, websocket.TextMessage, e.MessageType)
+		if i > 0 {
+			assert.False(t, e.Time.Before(history[i-1].Time))
+		}
+	}
+	assert.Equal(t, []frame{
+		{Outbound, "1"},
+		{Inbound, "re:1"},
+		{Outbound, "2"},
+		{Inbound, "re:2"},
+	}, got)
+
+	assert.Nil(t, NewWSClient(u).History())
+}
+
+func TestFrameTap(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.BinaryMessage, append([]byte("re:"), data...))
+		conn.ReadMessage()
+	})
+
+	type frame struct {
+		dir  Direction
+		mt   int
+		data string
+	}
+	tapped := make(chan frame, 2)
+	ws := NewWSClient(u, WithFrameTap(func(dir Direction, mt int, data []byte) {
+		tapped <- frame{dir, mt, string(data)}
+	}))
+	received := make(chan string, 1)
+	ws.OnMessage(func(data []byte) {
+		received <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendText("hello"))
+	select {
+	case data := <-received:
+		assert.Equal(t, "re:hello", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for echo")
+	}
+	// the inbound frame is tapped before it is handled
+	assert.Len(t, tapped, 2)
+	assert.Equal(t, frame{Outbound, websocket.TextMessage, "hello"}, <-tapped)
+	assert.Equal(t, frame{Inbound, websocket.BinaryMessage, "re:hello"}, <-tapped)
+}
@@ -0,0 +1,50 @@
+package wsclient
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithPingInterval makes the client send a ping control frame to the server
+// every interval to keep the connection alive. Pings are written ahead of
+// the queued messages, so heavy sending does not delay them.
+func WithPingInterval(interval time.Duration) Option {
+	return func(c *WSClient) {
+		c.pingInterval = interval
+	}
+}
+
+// writePing writes a keepalive ping to conn
+func (c *WSClient) writePing(conn *connection) error {
+	return c.write(conn.ws, websocket.PingMessage, nil, time.Time{})
+}
+
+// WithTCPKeepAlive enables TCP keepalive with the given period on the
+// connection to the server, for the operating system to detect a dead peer
+// independently of WebSocket pings, e.g. behind middleboxes that drop idle
+// connections silently. It has no effect on connections other than TCP,
+// such as those returned by a custom WithNetDialContext.
+func WithTCPKeepAlive(period time.Duration) Option {
+	return func(c *WSClient) {
+		c.tcpKeepAlive = period
+	}
+}
+
+// setTCPKeepAlive enables TCP keepalive on conn if it is a TCP connection,
+// possibly wrapped in TLS
+func setTCPKeepAlive(conn net.Conn, period time.Duration) error {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if err := tcp.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcp.SetKeepAlivePeriod(period)
+}
@@ -0,0 +1,110 @@
+package wsclient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingIntervalUnderLoad(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	pings := make(chan time.Time, 100)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.SetPingHandler(func(string) error {
+			select {
+			case pings <- time.Now():
+			default:
+			}
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	ws := NewWSClient(u, WithPingInterval(interval), WithLogger(discardLogger{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer waitShutdown(t, ws)
+	defer ws.Close()
+
+	// keep the send queue saturated
+	stop := make(chan struct{})
+	flooding := make(chan struct{})
+	go func() {
+		defer close(flooding)
+		payload := strings.Repeat("x", 1024)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if ws.SendText(payload) != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-flooding
+	}()
+
+	start := time.Now()
+	last := start
+	for i := 0; i < 5; i++ {
+		select {
+		case at := <-pings:
+			assert.Less(t, int64(at.Sub(last)), int64(4*interval), "ping %d late", i)
+			last = at
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ping")
+		}
+	}
+}
+
+func TestTCPKeepAlive(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		conn.ReadMessage()
+	})
+
+	logger := &captureLogger{}
+	received := make(chan string, 1)
+	ws := NewWSClient(u, WithLogger(logger), WithTCPKeepAlive(15*time.Second))
+	ws.OnMessage(func(data []byte) {
+		received <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "hello", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+	for _, line := range logger.Lines() {
+		assert.NotContains(t, line, "TCP keepalive")
+	}
+
+	// a no-op for other transports
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	assert.NoError(t, setTCPKeepAlive(client, time.Second))
+}
@@ -0,0 +1,78 @@
+package wsclient
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// Logger is the interface used for the client's log output. *log.Logger
+// implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger sets the logger for the client's log output. The default is the
+// standard logger of the log package.
+func WithLogger(l Logger) Option {
+	return func(c *WSClient) {
+		c.logger = l
+	}
+}
+
+// WithName sets a name that labels the client's log output, to tell apart
+// clients connected to different upstreams. It defaults to the host of the
+// WebSocket URL.
+func WithName(name string) Option {
+	return func(c *WSClient) {
+		c.name = name
+	}
+}
+
+// Name returns the name of the client as set with WithName
+func (c *WSClient) Name() string {
+	return c.name
+}
+
+// defaultName returns the host of the WebSocket URL u, or u itself if it
+// cannot be parsed
+func defaultName(u string) string {
+	p, err := url.Parse(u)
+	if err != nil || p.Host == "" {
+		return u
+	}
+	return p.Host
+}
+
+// logf logs a message prefixed with the client's name
+func (c *WSClient) logf(format string, v ...interface{}) {
+	msg := fmt.Sprintf("[%s] %s", c.name, fmt.Sprintf(format, v...))
+	if l, ok := c.logger.(*log.Logger); ok {
+		// report the caller of logf as the source of the message
+		l.Output(2, msg)
+		return
+	}
+	c.logger.Printf("%s", msg)
+}
+
+// WithPayloadLogging logs the payload of every data frame received from or
+// written to the server, for debugging. Each payload is passed through
+// redact before it is logged, e.g. to mask credentials; redact receives a
+// copy that it may modify. Payloads are not logged by default.
+func WithPayloadLogging(redact func(data []byte) []byte) Option {
+	return func(c *WSClient) {
+		c.redactPayload = redact
+	}
+}
+
+// logPayload logs a frame received from or written to the server
+func (c *WSClient) logPayload(dir Direction, mt int, data []byte) {
+	kind := "text"
+	if mt == websocket.BinaryMessage {
+		kind = "binary"
+	}
+	data = c.redactPayload(append([]byte(nil), data...))
+	c.logf("%s %s: %s", dir, kind, data)
+}
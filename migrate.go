@@ -0,0 +1,62 @@
+package wsclient
+
+import "context"
+
+// Migrate moves the client to the server at newURL without a gap in service,
+// e.g. when the current server announces a planned shutdown. The connection
+// to newURL is established first; the current connection is only closed
+// once it is up. Messages sent in the meantime, as well as those queued in
+// the outbox, are written to the new connection, and OnReconnect is called.
+// newURL is used for later reconnections too.
+//
+// Migrate returns ErrNotConnected if there is no open connection, e.g. while
+// reconnecting, and the dial error if newURL cannot be reached, in which
+// case the current connection is kept.
+func (c *WSClient) Migrate(ctx context.Context, newURL string) error {
+	old := c.currentConn()
+	if old == nil {
+		return ErrNotConnected
+	}
+	ctx, cancel := c.contextUntil(ctx, old.closing)
+	defer cancel()
+	ws, resp, err := c.dialURL(ctx, newURL)
+	if err != nil {
+		return err
+	}
+
+	if !c.retire(old) {
+		// the connection was lost while dialing and is being
+		// re-established already
+		ws.Close()
+		return ErrNotConnected
+	}
+	// hand the send channel over only once the old writer stopped, so that
+	// the messages keep their order
+	<-old.writeDone
+	c.SetURL(newURL)
+	if !c.start(ws, resp, old.closing) {
+		return ErrClosed
+	}
+	c.goroutine(func() { c.closeConn(old) })
+	if err := c.reconnectReady(ctx); err != nil {
+		return err
+	}
+	if fn := c.callbacks().onReconnect; fn != nil {
+		fn()
+	}
+	return nil
+}
+
+// retire ends conn after it was replaced by another connection. It returns
+// false if conn had already ended.
+func (c *WSClient) retire(conn *connection) bool {
+	retired := false
+	conn.once.Do(func() {
+		retired = true
+		close(conn.done)
+		if fn := c.callbacks().onDisconnect; fn != nil {
+			fn(conn.disconnectInfo())
+		}
+	})
+	return retired
+}
@@ -0,0 +1,96 @@
+package wsclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	const count = 200
+	// newNode starts a server that passes the received messages to received
+	// and the error that ended the connection to closed
+	newNode := func(received chan<- int, closed chan<- error) string {
+		return newTestServer(t, func(conn *websocket.Conn) {
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					closed <- err
+					return
+				}
+				n, _ := strconv.Atoi(string(data))
+				received <- n
+			}
+		})
+	}
+	receivedA, receivedB := make(chan int, count), make(chan int, count)
+	closedA, closedB := make(chan error, 1), make(chan error, 1)
+	a := newNode(receivedA, closedA)
+	b := newNode(receivedB, closedB)
+
+	reconnected := make(chan bool, 1)
+	ws := NewWSClient(a)
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i < count; i++ {
+			assert.NoError(t, ws.SendText(strconv.Itoa(i)))
+			if i == count/2 {
+				// give Migrate a chance to run mid-stream
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}()
+	assert.NoError(t, ws.Migrate(ctx, b))
+	<-sent
+	assert.Equal(t, b, ws.URL())
+
+	// node A got a proper close once node B took over
+	select {
+	case err := <-closedA:
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for node A to be closed")
+	}
+	select {
+	case <-reconnected:
+	default:
+		t.Error("OnReconnect not called")
+	}
+
+	// no message was lost or reordered in the switch: node A got the first
+	// ones, node B the rest
+	i := 0
+	for len(receivedA) > 0 {
+		assert.Equal(t, i, <-receivedA)
+		i++
+	}
+	for ; i < count; i++ {
+		select {
+		case n := <-receivedB:
+			assert.Equal(t, i, n)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+	ws.Close()
+	waitShutdown(t, ws)
+}
+
+func TestMigrateNotConnected(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	assert.Equal(t, ErrNotConnected, ws.Migrate(context.Background(), "ws://localhost:8083"))
+}
@@ -0,0 +1,55 @@
+package wsclient
+
+import "context"
+
+// StreamReader receives the messages of one logical stream multiplexed over
+// the connection, see Stream
+type StreamReader struct {
+	id     string
+	ch     <-chan []byte
+	cancel context.CancelFunc
+}
+
+// WithStreamField sets the name of the field that holds the stream id of
+// JSON messages, see Stream. The default is "stream".
+func WithStreamField(field string) Option {
+	return func(c *WSClient) {
+		c.streamField = field
+	}
+}
+
+// Stream returns a reader of the messages from the server whose stream
+// field, see WithStreamField, is id, for servers multiplexing several
+// logical streams over one connection. The messages of the stream are
+// passed to the reader, in the order they were received, instead of
+// OnMessage.
+//
+// Each reader holds up to 16 messages. Once full, reading from the server
+// waits for it to catch up, which holds back the other streams too, as they
+// share the connection. The reader ends when Close is called or the client
+// is closed.
+func (c *WSClient) Stream(id string) *StreamReader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StreamReader{
+		id:     id,
+		ch:     c.subscribe(ctx, c.streamField, id),
+		cancel: cancel,
+	}
+}
+
+// ID returns the id of the stream
+func (r *StreamReader) ID() string {
+	return r.id
+}
+
+// Messages returns the channel receiving the messages of the stream. It is
+// closed when the reader ends.
+func (r *StreamReader) Messages() <-chan []byte {
+	return r.ch
+}
+
+// Close ends the reader. The messages of the stream received afterwards go
+// to OnMessage.
+func (r *StreamReader) Close() {
+	r.cancel()
+}
@@ -0,0 +1,67 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	start := make(chan bool)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		<-start
+		for i := 1; i <= 3; i++ {
+			conn.WriteJSON(M{"stream": "a", "n": i})
+			conn.WriteJSON(M{"stream": "b", "n": i})
+		}
+		conn.WriteJSON(M{"n": 0})
+		conn.ReadMessage()
+	})
+
+	other := make(chan string, 1)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		other <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	a, b := ws.Stream("a"), ws.Stream("b")
+	defer a.Close()
+	defer b.Close()
+	assert.Equal(t, "a", a.ID())
+	close(start)
+
+	for _, r := range []*StreamReader{a, b} {
+		for i := 1; i <= 3; i++ {
+			select {
+			case data := <-r.Messages():
+				assert.JSONEq(t, fmt.Sprintf(`{"stream":%q,"n":%d}`, r.ID(), i), string(data))
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for stream %s", r.ID())
+			}
+		}
+	}
+	select {
+	case data := <-other:
+		assert.JSONEq(t, `{"n":0}`, data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	a.Close()
+	select {
+	case _, ok := <-a.Messages():
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream to end")
+	}
+}
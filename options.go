@@ -0,0 +1,167 @@
+package wsclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// Option configures a WSClient. Options are passed to NewWSClient.
+type Option func(c *WSClient)
+
+// WithSendEnricher sets a function that is applied to every SendJSON payload
+// before it is marshaled, e.g. to inject a client id or sequence number into
+// all outbound messages. The map returned by fn is the one that is sent.
+func WithSendEnricher(fn func(M) M) Option {
+	return func(c *WSClient) {
+		c.sendEnricher = fn
+	}
+}
+
+// OutboundMiddleware transforms the payload of an outbound frame before it is
+// queued for writing
+type OutboundMiddleware func(messageType int, data []byte) []byte
+
+// WithOutboundMiddleware adds middleware that is applied to every frame sent
+// with SendJSON, SendJSONAck, SendText, SendBinary or SendRaw. Middleware
+// runs in the order it was added. Frames sent with SendPreEncoded bypass it.
+func WithOutboundMiddleware(mw OutboundMiddleware) Option {
+	return func(c *WSClient) {
+		c.outboundMiddleware = append(c.outboundMiddleware, mw)
+	}
+}
+
+// WithDefaultMessageType sets the frame type used by SendJSON, SendJSONAck and
+// SendText, for servers that expect all application data in binary frames.
+// mt must be websocket.TextMessage (the default) or websocket.BinaryMessage;
+// any other value panics.
+func WithDefaultMessageType(mt int) Option {
+	if !isDataMessageType(mt) {
+		panic(ErrInvalidMessageType)
+	}
+	return func(c *WSClient) {
+		c.messageType = mt
+	}
+}
+
+// WithTypeField sets the name of the field that holds the message type in
+// JSON messages, used by the features that act on messages of a given type.
+// The default is "type".
+func WithTypeField(field string) Option {
+	return func(c *WSClient) {
+		c.typeField = field
+	}
+}
+
+// WithReadBufferSize sets the size in bytes of the connection's read buffer.
+// Small buffers save memory with servers that send many small messages,
+// large ones reduce system calls for large messages. Messages larger than
+// the buffer are still received whole. The default is 4096 bytes.
+func WithReadBufferSize(n int) Option {
+	return func(c *WSClient) {
+		c.dialer.ReadBufferSize = n
+	}
+}
+
+// WithWriteBufferSize sets the size in bytes of the connection's write
+// buffer, which also bounds the size of the frames written: larger messages
+// are split into several frames. The default is 4096 bytes.
+func WithWriteBufferSize(n int) Option {
+	return func(c *WSClient) {
+		c.dialer.WriteBufferSize = n
+	}
+}
+
+// WithDialer sets the dialer used for the handshake, for settings that have
+// no dedicated option. The dialer is copied. Options that adjust the dialer,
+// like WithCompression or WithReadBufferSize, must come after WithDialer.
+// The proxy of the dialer is used as is: a dialer without Proxy connects
+// directly, ignoring the environment.
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *WSClient) {
+		dialer := *d
+		c.dialer = &dialer
+	}
+}
+
+// WithProxy sets the function returning the URL of the proxy to connect
+// through for a handshake request, e.g. http.ProxyURL for a fixed proxy. A
+// nil URL or a nil function connects directly. The default is
+// http.ProxyFromEnvironment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *WSClient) {
+		c.dialer.Proxy = proxy
+	}
+}
+
+// WithHeaderFunc sets a function returning the HTTP headers of the handshake.
+// It is called before every dial, the initial one and each reconnection
+// attempt, so that short-lived credentials such as auth tokens can be
+// refreshed. An error aborts the attempt as if the dial had failed.
+func WithHeaderFunc(fn func() (http.Header, error)) Option {
+	return func(c *WSClient) {
+		c.headerFunc = fn
+	}
+}
+
+// WithHandshakeSigner sets a function called with the handshake request
+// right before every dial, the initial one and each reconnection attempt,
+// e.g. to sign it with an HMAC over a timestamp and a nonce. It runs after
+// the headers from WithHeaderFunc are set, and the headers it sets on req
+// are sent with the handshake; the other fields of req are for reading
+// only. An error aborts the attempt as if the dial had failed.
+func WithHandshakeSigner(fn func(req *http.Request) error) Option {
+	return func(c *WSClient) {
+		c.handshakeSigner = fn
+	}
+}
+
+// WithReadLimit sets the maximum size in bytes of a message read from the
+// server. A larger message ends the connection with an error for which
+// IsReadLimitError is true. There is no limit by default.
+func WithReadLimit(n int64) Option {
+	return func(c *WSClient) {
+		c.readLimit = n
+	}
+}
+
+// WithNetDialContext sets the function that opens the network connection to
+// the server, e.g. to connect to another address than the host of the URL.
+// The Host header and the TLS server name are still taken from the URL.
+func WithNetDialContext(fn func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(c *WSClient) {
+		c.dialer.NetDialContext = fn
+	}
+}
+
+// WithBinaryToOnMessage sets whether binary frames are passed to OnMessage
+// when OnBinaryMessage is not set, which they are by default. With false,
+// OnMessage only receives text frames, e.g. for a handler written for text,
+// and binary frames go to OnBinaryMessage, or OnUnhandledFrame without it.
+func WithBinaryToOnMessage(deliver bool) Option {
+	return func(c *WSClient) {
+		c.textOnlyMessages = !deliver
+	}
+}
+
+// WithStrictErrors makes the client panic on errors that would be passed to
+// OnError when no OnError callback is set, instead of dropping them. It is
+// meant for development, to surface errors that would go unnoticed.
+func WithStrictErrors() Option {
+	return func(c *WSClient) {
+		c.strictErrors = true
+	}
+}
+
+// WithExpectedCloseCodes adds close codes that end a connection normally for
+// the protocol spoken with the server, besides websocket.CloseNormalClosure.
+// A server closing the connection with one of them is neither logged as an
+// unexpected close nor reported to OnError.
+func WithExpectedCloseCodes(codes ...int) Option {
+	return func(c *WSClient) {
+		c.expectedCloseCodes = append(c.expectedCloseCodes, codes...)
+	}
+}
@@ -0,0 +1,69 @@
+package wsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// WithKeyOrder makes the client serialize the keys of the JSON messages it
+// sends in a fixed order, for servers that verify a signature over the exact
+// bytes of a message: the given keys first, in that order, then the other
+// keys in alphabetical order, the order of encoding/json. Nested objects are
+// serialized by encoding/json, with their keys in alphabetical order. Keys
+// missing from a message are skipped. The serialization is otherwise
+// identical to json.Marshal. The messages are not marshaled into pooled
+// buffers then, see WithPooledBuffers.
+func WithKeyOrder(keys ...string) Option {
+	return func(c *WSClient) {
+		c.keyOrder = append([]string(nil), keys...)
+	}
+}
+
+// marshalJSON marshals j, in the order set with WithKeyOrder if any
+func (c *WSClient) marshalJSON(j M) ([]byte, error) {
+	if len(c.keyOrder) == 0 {
+		return json.Marshal(j)
+	}
+	if j == nil {
+		return []byte("null"), nil
+	}
+
+	keys := make([]string, 0, len(j))
+	ordered := make(map[string]bool, len(c.keyOrder))
+	for _, k := range c.keyOrder {
+		if _, ok := j[k]; ok && !ordered[k] {
+			ordered[k] = true
+			keys = append(keys, k)
+		}
+	}
+	rest := make([]string, 0, len(j)-len(keys))
+	for k := range j {
+		if !ordered[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(j[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
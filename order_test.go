@@ -0,0 +1,51 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyOrder(t *testing.T) {
+	received := make(chan string, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithKeyOrder("type", "id", "missing", "type"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendJSON(M{
+		"sig":  "a<b",
+		"id":   7,
+		"data": M{"z": 1, "a": []int{1, 2}},
+		"type": "order",
+	}))
+	assert.NoError(t, ws.SendJSONBatch([]M{{"b": 1, "type": "x"}, {"id": 2, "a": true}}))
+
+	for _, want := range []string{
+		`{"type":"order","id":7,"data":{"a":[1,2],"z":1},"sig":"a\u003cb"}`,
+		`[{"type":"x","b":1},{"id":2,"a":true}]`,
+	} {
+		select {
+		case data := <-received:
+			assert.Equal(t, want, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
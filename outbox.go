@@ -0,0 +1,121 @@
+package wsclient
+
+import (
+	"errors"
+)
+
+// ErrOutboxFull is returned when a message cannot be queued because the
+// outbox set with WithOutbox is full
+var ErrOutboxFull = errors.New("wsclient: outbox full")
+
+// WithOutbox makes sends made before the client is connected, or while it is
+// reconnecting, wait in a queue of up to size messages instead of failing
+// with ErrNotConnected or ErrReconnecting. The queue is written to the connection,
+// in order and ahead of any later message, as soon as the client has
+// (re)connected. Sends fail with ErrOutboxFull while the queue is full.
+// Messages still queued when the client is closed are dropped; the ack
+// channels of SendJSONAck receive ErrClosed for them.
+//
+// Reconnecting only applies with WithReconnect; without it a lost connection
+// closes the client and sends fail with ErrClosed.
+func WithOutbox(size int) Option {
+	return func(c *WSClient) {
+		c.outboxSize = size
+		c.offline = size > 0
+	}
+}
+
+// queueOutbox adds m to the outbox if the client is reconnecting. It returns
+// false if m should be handed to writePump instead.
+func (c *WSClient) queueOutbox(m *message) (bool, error) {
+	c.outboxMu.Lock()
+	defer c.outboxMu.Unlock()
+	if !c.offline {
+		return false, nil
+	}
+	if len(c.outbox) >= c.outboxSize {
+		return true, ErrOutboxFull
+	}
+	c.outbox = append(c.outbox, m)
+	return true, nil
+}
+
+// setOffline switches between queueing sends in the outbox and handing them
+// to writePump
+func (c *WSClient) setOffline(offline bool) {
+	c.outboxMu.Lock()
+	c.offline = offline
+	c.outboxMu.Unlock()
+}
+
+// flushOutbox writes the queued messages to conn and makes later sends go to
+// writePump. If a write fails, the messages after the failed one are queued
+// again for the next connection. Nothing is flushed if conn already ended
+// before writePump got to run.
+func (c *WSClient) flushOutbox(conn *connection) error {
+	c.outboxMu.Lock()
+	offline := c.offline
+	c.outboxMu.Unlock()
+	if offline && !isDone(conn.done) {
+		// the messages left in the send buffer when the connection was lost
+		// were sent before the ones in the outbox
+		if err := c.writeBuffered(conn); err != nil {
+			return err
+		}
+	}
+
+	c.outboxMu.Lock()
+	if isDone(conn.done) {
+		c.outboxMu.Unlock()
+		return nil
+	}
+	queued := c.outbox
+	c.outbox = nil
+	c.offline = false
+	c.outboxMu.Unlock()
+
+	for i, m := range queued {
+		if err := c.writeMessage(conn, m); err != nil {
+			c.outboxMu.Lock()
+			c.outbox = append(queued[i+1:], c.outbox...)
+			c.outboxMu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBuffered writes the messages waiting in the send buffer to conn, the
+// priority ones first
+func (c *WSClient) writeBuffered(conn *connection) error {
+	for {
+		var m *message
+		select {
+		case m = <-c.priority:
+		case m = <-c.send:
+		default:
+			return nil
+		}
+		if err := c.writeMessage(conn, m); err != nil {
+			return err
+		}
+	}
+}
+
+// dropOutbox discards the queued messages after the client was closed
+func (c *WSClient) dropOutbox() {
+	c.outboxMu.Lock()
+	queued := c.outbox
+	c.outbox = nil
+	c.outboxMu.Unlock()
+
+	for _, m := range queued {
+		if !m.barrier {
+			c.drop(m.data, DropClosed)
+		}
+		m.release()
+		if m.ack != nil {
+			m.ack <- ErrClosed
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	var conns int32
+	received := make(chan []byte, 2)
+	// the reconnect is held until the sends during the gap are done
+	gap := make(chan struct{})
+	var endGap sync.Once
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := atomic.AddInt32(&conns, 1) == 1
+		if !first {
+			<-gap
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if first {
+			return
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- data
+		}
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { endGap.Do(func() { close(gap) }) })
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	ws := NewWSClient(u, WithOutbox(1), WithReconnect(ReconnectConfig{
+		InitialDelay: 100 * time.Millisecond,
+	}))
+	states := ws.WatchState()
+	ws.Connect()
+	defer ws.Close()
+	for s := range states {
+		if s == StateBackingOff {
+			break
+		}
+	}
+
+	// sends during the gap are queued, up to the outbox size
+	assert.NoError(t, ws.SendJSON(M{"op": "queued"}))
+	assert.Equal(t, ErrOutboxFull, ws.SendJSON(M{"op": "overflow"}))
+	endGap.Do(func() { close(gap) })
+
+	select {
+	case data := <-received:
+		assert.JSONEq(t, `{"op":"queued"}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for queued message")
+	}
+
+	// once reconnected, sends go straight to the connection again
+	assert.NoError(t, ws.SendJSON(M{"op": "direct"}))
+	select {
+	case data := <-received:
+		assert.JSONEq(t, `{"op":"direct"}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for direct message")
+	}
+}
+
+func TestOutboxBeforeOpen(t *testing.T) {
+	received := make(chan []byte, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if err == nil {
+			received <- data
+		}
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u, WithOutbox(1))
+	assert.NoError(t, ws.SendJSON(M{"op": "early"}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case data := <-received:
+		assert.JSONEq(t, `{"op":"early"}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for queued message")
+	}
+}
+
+func TestOutboxAfterSendBuffer(t *testing.T) {
+	var conns int32
+	first := make(chan bool)
+	received := make(chan string, 3)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&conns, 1) == 1 {
+			conn.ReadMessage()
+			<-first
+			return
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	// stall the writer after its first write, so that the next messages
+	// are still in the send buffer when the connection is lost
+	stalled := make(chan bool)
+	release := make(chan bool)
+	defer close(release)
+	ws := NewWSClient(u, WithSendBuffer(2), WithOutbox(2), WithReconnect(ReconnectConfig{
+		InitialDelay: 200 * time.Millisecond,
+	}))
+	ws.OnBytesWritten(func(int) {
+		select {
+		case stalled <- true:
+			<-release
+		default:
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	go ws.SendText("first")
+	<-stalled
+	assert.NoError(t, ws.SendJSON(M{"n": 0}))
+	assert.NoError(t, ws.SendJSON(M{"n": 1}))
+	close(first)
+	assert.NoError(t, ws.WaitState(ctx, StateBackingOff))
+	assert.NoError(t, ws.SendJSON(M{"n": 2}))
+
+	for i := 0; i < 3; i++ {
+		select {
+		case data := <-received:
+			assert.JSONEq(t, fmt.Sprintf(`{"n":%d}`, i), data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
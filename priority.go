@@ -0,0 +1,21 @@
+package wsclient
+
+// SendJSONPriority sends a JSON encoded message to the server like SendJSON,
+// ahead of the messages waiting in the send buffer, see WithSendBuffer, e.g.
+// for a command aborting the transfer they belong to. It is written as soon
+// as the writer is done with the frame being written. This reorders the
+// message relative to the sends made before it, by design; priority messages
+// keep their order among themselves, and may land between the messages of a
+// Batch committed at the same time. They wait in a buffer of their own, of
+// the same size as the send buffer, which QueueDepth does not count. While
+// reconnecting with the outbox enabled, see WithOutbox, the message is
+// queued after the messages already in the outbox.
+func (c *WSClient) SendJSONPriority(j M) error {
+	m, err := c.newJSONMessage(c.messageType, j)
+	if err != nil {
+		c.logf("SendJSONPriority: Marshal error: %s", err.Error())
+		return err
+	}
+	m.priority = true
+	return c.enqueueLocked(m, true)
+}
@@ -0,0 +1,68 @@
+package wsclient
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Probe measures the round-trip time to the server by sending a ping control
+// frame and waiting for the matching pong. It fails if ctx is done before the
+// pong arrives. Pongs are only received while the read pump is running,
+// which is always the case while connected.
+func (c *WSClient) Probe(ctx context.Context) (time.Duration, error) {
+	conn := c.currentConn()
+	if conn == nil {
+		if c.isClosed() {
+			return 0, ErrClosed
+		}
+		return 0, ErrNotConnected
+	}
+
+	payload := "probe-" + strconv.FormatUint(atomic.AddUint64(&c.probeID, 1), 10)
+	pong := make(chan struct{}, 1)
+	c.probesMu.Lock()
+	c.probes[payload] = pong
+	c.probesMu.Unlock()
+	defer func() {
+		c.probesMu.Lock()
+		delete(c.probes, payload)
+		c.probesMu.Unlock()
+	}()
+
+	deadline := time.Now().Add(writeWait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	start := time.Now()
+	if err := conn.ws.WriteControl(websocket.PingMessage, []byte(payload), deadline); err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-pong:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-conn.done:
+		return 0, ErrNotConnected
+	}
+}
+
+// handlePong is the pong handler of every connection. It completes the Probe
+// waiting for appData, if any.
+func (c *WSClient) handlePong(appData string) error {
+	c.probesMu.Lock()
+	pong, ok := c.probes[appData]
+	c.probesMu.Unlock()
+	if ok {
+		select {
+		case pong <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
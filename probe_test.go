@@ -0,0 +1,64 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	// the server answers pings while it reads
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	rtt, err := ws.Probe(ctx)
+	assert.NoError(t, err)
+	assert.True(t, rtt > 0)
+	assert.True(t, rtt < time.Second, "rtt %s", rtt)
+	// probes do not use up request ids
+	assert.Equal(t, "1", ws.newID())
+}
+
+func TestProbeTimeout(t *testing.T) {
+	// a server that never reads never answers pings
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		<-release
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	probeCtx, probeCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer probeCancel()
+	_, err := ws.Probe(probeCtx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestProbeNotConnected(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	_, err := ws.Probe(context.Background())
+	assert.Equal(t, ErrNotConnected, err)
+}
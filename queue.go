@@ -0,0 +1,74 @@
+package wsclient
+
+// WithSendBuffer lets up to n messages wait for the writer, so that sends
+// return without waiting for the previous messages to be written. By
+// default there is no buffer: a send waits until the writer takes the
+// message. Buffered messages that are not written by the time the client is
+// closed are dropped, their SendJSONAck channels receiving ErrClosed.
+func WithSendBuffer(n int) Option {
+	return func(c *WSClient) {
+		if n < 0 {
+			n = 0
+		}
+		c.send = make(chan *message, n)
+	}
+}
+
+// QueueDepth returns the number of messages in the send buffer waiting to be
+// written, see WithSendBuffer. It does not count the messages in the outbox.
+func (c *WSClient) QueueDepth() int {
+	return len(c.send)
+}
+
+// QueueCapacity returns the size of the send buffer, see WithSendBuffer.
+// Sends wait for the writer while QueueDepth is QueueCapacity.
+func (c *WSClient) QueueCapacity() int {
+	return cap(c.send)
+}
+
+// WouldBlockSend reports whether a non-blocking send, see FireJSON, would
+// fail right now: the client is not connected, or draining, or the send
+// buffer is full, or, while reconnecting with the outbox enabled, the outbox
+// is full. Producers can check it to skip building a message that would be
+// dropped anyway. It is only a snapshot: the next send can still find the
+// writer busy. Without a send buffer, see WithSendBuffer, whether the writer
+// is free cannot be told without sending, and WouldBlockSend reports false
+// while connected.
+func (c *WSClient) WouldBlockSend() bool {
+	if isDone(c.closing()) || c.isDraining() {
+		return true
+	}
+	if c.outboxSize > 0 {
+		c.outboxMu.Lock()
+		offline, full := c.offline, len(c.outbox) >= c.outboxSize
+		c.outboxMu.Unlock()
+		if offline {
+			return full
+		}
+	}
+	if c.unavailable() != nil {
+		return true
+	}
+	return cap(c.send) > 0 && len(c.send) >= cap(c.send)
+}
+
+// dropQueued discards the messages left in the send buffer, and the priority
+// messages, after the client was closed
+func (c *WSClient) dropQueued() {
+	for {
+		var m *message
+		select {
+		case m = <-c.priority:
+		case m = <-c.send:
+		default:
+			return
+		}
+		if !m.barrier {
+			c.drop(m.data, DropClosed)
+		}
+		m.release()
+		if m.ack != nil {
+			m.ack <- ErrClosed
+		}
+	}
+}
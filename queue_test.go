@@ -0,0 +1,221 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueDepth(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	// stall the writer after its first write
+	stalled := make(chan bool)
+	release := make(chan bool)
+	ws := NewWSClient(u, WithSendBuffer(3))
+	ws.OnBytesWritten(func(int) {
+		select {
+		case stalled <- true:
+			<-release
+		default:
+		}
+	})
+	assert.Equal(t, 3, ws.QueueCapacity())
+	assert.Equal(t, 0, ws.QueueDepth())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	go ws.SendText("first")
+	<-stalled
+	var acks []<-chan error
+	for i := 0; i < 3; i++ {
+		ack, err := ws.SendJSONAck(M{"n": i})
+		assert.NoError(t, err)
+		acks = append(acks, ack)
+		assert.Equal(t, i+1, ws.QueueDepth())
+	}
+	ws.FireJSON(M{"n": 3})
+	assert.Equal(t, 3, ws.QueueDepth())
+
+	// the queued messages are dropped on Close
+	ws.Close()
+	for _, ack := range acks {
+		select {
+		case err := <-ack:
+			assert.Equal(t, ErrClosed, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ack")
+		}
+	}
+	assert.Equal(t, 0, ws.QueueDepth())
+	close(release)
+	waitShutdown(t, ws)
+}
+
+func TestSendBuffer(t *testing.T) {
+	release := make(chan bool)
+	received := make(chan string, 3)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		<-release
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	ws := NewWSClient(u, WithSendBuffer(3))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for _, s := range []string{"a", "b", "c"} {
+		assert.NoError(t, ws.SendText(s))
+	}
+	close(release)
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case data := <-received:
+			assert.Equal(t, want, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+	assert.Equal(t, 0, ws.QueueDepth())
+}
+
+func TestWouldBlockSend(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	// stall the writer after its first write
+	stalled := make(chan bool)
+	release := make(chan bool)
+	ws := NewWSClient(u, WithSendBuffer(2))
+	ws.OnBytesWritten(func(int) {
+		select {
+		case stalled <- true:
+			<-release
+		default:
+		}
+	})
+	assert.True(t, ws.WouldBlockSend())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	assert.False(t, ws.WouldBlockSend())
+
+	go ws.SendText("first")
+	<-stalled
+	for i := 0; i < 2; i++ {
+		assert.False(t, ws.WouldBlockSend())
+		assert.NoError(t, ws.SendJSON(M{"n": i}))
+	}
+	assert.True(t, ws.WouldBlockSend())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return !ws.WouldBlockSend()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSendJSONPriority(t *testing.T) {
+	received := make(chan string, 5)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	// pace the writer: it waits for a token after every write
+	stalled := make(chan bool, 1)
+	tokens := make(chan bool)
+	ws := NewWSClient(u, WithSendBuffer(3))
+	ws.OnBytesWritten(func(int) {
+		select {
+		case stalled <- true:
+		default:
+		}
+		<-tokens
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	go ws.SendText("first")
+	<-stalled
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ws.SendJSON(M{"n": i}))
+	}
+	assert.NoError(t, ws.SendJSONPriority(M{"op": "abort"}))
+	assert.Equal(t, 3, ws.QueueDepth())
+	close(tokens)
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		select {
+		case data := <-received:
+			got = append(got, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+	assert.Equal(t, []string{
+		"first",
+		`{"op":"abort"}`,
+		`{"n":0}`,
+		`{"n":1}`,
+		`{"n":2}`,
+	}, got)
+}
+
+func TestSendBufferAfterClose(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u, WithSendBuffer(32))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	ws.Close()
+	// there is room in the buffer, but the client is closed
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, ErrClosed, ws.SendJSON(M{"n": i}))
+	}
+	waitShutdown(t, ws)
+}
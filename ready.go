@@ -0,0 +1,81 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotReady is returned when the server did not send the ready signal in
+// time, see WithReadySignal
+var ErrNotReady = errors.New("wsclient: ready signal not received")
+
+// WithReadySignal makes the client wait after the handshake until the server
+// signals that it is ready with a message for which match returns true, e.g.
+// {"type":"ready"}, before the connection counts as open: Open returns and
+// OnOpen is called only then, and OnReconnect after a reconnection. The
+// ready message is not passed to the handlers; messages received before it
+// are.
+//
+// If the message does not arrive within timeout, 0 for no limit other than
+// the context, Open closes the client and returns ErrNotReady, and a
+// reconnected connection is dropped, to be re-established by automatic
+// reconnection if enabled; Reconnect and Migrate return ErrNotReady then.
+// It has no effect with OnReader.
+func WithReadySignal(match func(data []byte) bool, timeout time.Duration) Option {
+	return func(c *WSClient) {
+		c.readyMatch = match
+		c.readyTimeout = timeout
+	}
+}
+
+// awaitReady waits for the ready signal on conn, see WithReadySignal
+func (c *WSClient) awaitReady(ctx context.Context, conn *connection) error {
+	if conn.ready == nil {
+		return nil
+	}
+	var timeout <-chan time.Time
+	if c.readyTimeout > 0 {
+		t := time.NewTimer(c.readyTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-conn.ready:
+		return nil
+	case <-conn.readDone:
+		if err := conn.reason(); err != nil {
+			return err
+		}
+		return ErrNotConnected
+	case <-timeout:
+		return ErrNotReady
+	case <-ctx.Done():
+		if isDone(conn.closing) {
+			return ErrClosed
+		}
+		return ctx.Err()
+	}
+}
+
+// reconnectReady waits for the ready signal on the connection just
+// re-established, and drops it if the signal does not arrive, like a lost
+// connection
+func (c *WSClient) reconnectReady(ctx context.Context) error {
+	conn := c.startedConn()
+	err := c.awaitReady(ctx, conn)
+	if err != nil && !isDone(conn.done) && !isDone(conn.closing) {
+		c.logf("ready: %s", err.Error())
+		conn.fail(err)
+		conn.ws.Close()
+	}
+	return err
+}
+
+// startedConn returns the connection set by the last start, which may have
+// ended already
+func (c *WSClient) startedConn() *connection {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.conn
+}
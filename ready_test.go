@@ -0,0 +1,81 @@
+package wsclient
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func isReady(data []byte) bool {
+	return bytes.Equal(data, []byte(`{"type":"ready"}`))
+}
+
+func TestReadySignal(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"warming"}`))
+		time.Sleep(100 * time.Millisecond)
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ready"}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	var mu sync.Mutex
+	var events []string
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithReadySignal(isReady, 5*time.Second))
+	ws.OnMessage(func(data []byte) {
+		mu.Lock()
+		events = append(events, string(data))
+		mu.Unlock()
+	})
+	ws.OnOpen(func() {
+		mu.Lock()
+		events = append(events, "open")
+		mu.Unlock()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "opened after %s", time.Since(start))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{`{"type":"warming"}`, "open"}, events)
+}
+
+func TestReadySignalTimeout(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	opened := false
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithReadySignal(isReady, 50*time.Millisecond))
+	ws.OnOpen(func() {
+		opened = true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Equal(t, ErrNotReady, ws.Open(ctx))
+	assert.False(t, opened)
+	waitShutdown(t, ws)
+}
@@ -0,0 +1,92 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// receiver is a ReceiveJSON or WaitFor call waiting for a message
+type receiver struct {
+	// match, if set, selects the messages the receiver takes
+	match func(data []byte) bool
+	// ch is buffered so that a message can be handed over without blocking
+	ch chan []byte
+}
+
+// ReceiveJSON waits for the next message from the server and decodes it into
+// v. While ReceiveJSON is waiting, the next message is passed to it instead of
+// OnMessage; concurrent calls receive the messages in the order they were
+// made. Messages that arrive while no call is waiting go to the callbacks as
+// usual. It returns ctx.Err() if ctx is done first, and ErrClosed if the
+// client is closed.
+func (c *WSClient) ReceiveJSON(ctx context.Context, v interface{}) error {
+	data, err := c.receive(ctx, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WaitFor waits for the first message from the server for which match returns
+// true, e.g. a message telling that the server is ready, and returns it. The
+// matching message is not passed to OnMessage; the other messages are. It
+// returns ctx.Err() if ctx is done first, and ErrClosed if the client is
+// closed. match is called from the read goroutine.
+func (c *WSClient) WaitFor(ctx context.Context, match func(data []byte) bool) ([]byte, error) {
+	return c.receive(ctx, match)
+}
+
+// receive waits for the next message accepted by match, any message if match
+// is nil
+func (c *WSClient) receive(ctx context.Context, match func(data []byte) bool) ([]byte, error) {
+	done := c.closing()
+	r := &receiver{match: match, ch: make(chan []byte, 1)}
+	c.receiversMu.Lock()
+	c.receivers = append(c.receivers, r)
+	c.receiversMu.Unlock()
+
+	var err error
+	select {
+	case data := <-r.ch:
+		return data, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-done:
+		err = ErrClosed
+	}
+	if !c.removeReceiver(r) {
+		// a message was handed over in the meantime
+		return <-r.ch, nil
+	}
+	return nil, err
+}
+
+// removeReceiver removes r from the waiting receivers. It returns false if r
+// was already removed by deliverReceive.
+func (c *WSClient) removeReceiver(r *receiver) bool {
+	c.receiversMu.Lock()
+	defer c.receiversMu.Unlock()
+	for i, other := range c.receivers {
+		if other == r {
+			c.receivers = append(c.receivers[:i], c.receivers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// deliverReceive passes data to the longest waiting receiver that accepts it.
+// It returns false if there is none.
+func (c *WSClient) deliverReceive(data []byte) bool {
+	c.receiversMu.Lock()
+	defer c.receiversMu.Unlock()
+	for i, r := range c.receivers {
+		if r.match != nil && !r.match(data) {
+			continue
+		}
+		r.ch <- c.retain(data)
+		c.receivers = append(c.receivers[:i], c.receivers[i+1:]...)
+		return true
+	}
+	return false
+}
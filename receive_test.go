@@ -0,0 +1,116 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveJSON(t *testing.T) {
+	push := make(chan string)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for text := range push {
+			conn.WriteMessage(websocket.TextMessage, []byte(text))
+		}
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		t.Errorf("OnMessage called: %s", data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	type price struct {
+		Symbol string  `json:"symbol"`
+		Price  float64 `json:"price"`
+	}
+	got := make(chan price)
+	go func() {
+		var v price
+		assert.NoError(t, ws.ReceiveJSON(ctx, &v))
+		got <- v
+	}()
+	// wait for ReceiveJSON to be waiting before the server pushes
+	assert.Eventually(t, func() bool {
+		ws.receiversMu.Lock()
+		defer ws.receiversMu.Unlock()
+		return len(ws.receivers) == 1
+	}, 5*time.Second, time.Millisecond)
+	push <- `{"symbol":"ACME","price":12.5}`
+	close(push)
+
+	select {
+	case v := <-got:
+		assert.Equal(t, price{"ACME", 12.5}, v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ReceiveJSON")
+	}
+
+	// nothing is pushed anymore
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	var v price
+	assert.Equal(t, context.DeadlineExceeded, ws.ReceiveJSON(short, &v))
+	assert.Empty(t, ws.receivers)
+}
+
+func TestWaitFor(t *testing.T) {
+	push := make(chan string)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for text := range push {
+			conn.WriteMessage(websocket.TextMessage, []byte(text))
+		}
+		conn.ReadMessage()
+	})
+
+	others := make(chan string, 2)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		others <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	got := make(chan []byte)
+	go func() {
+		data, err := ws.WaitFor(ctx, func(data []byte) bool {
+			var m M
+			return json.Unmarshal(data, &m) == nil && m["type"] == "ready"
+		})
+		assert.NoError(t, err)
+		got <- data
+	}()
+	assert.Eventually(t, func() bool {
+		ws.receiversMu.Lock()
+		defer ws.receiversMu.Unlock()
+		return len(ws.receivers) == 1
+	}, 5*time.Second, time.Millisecond)
+	push <- `{"type":"progress","pct":50}`
+	push <- `{"type":"progress","pct":100}`
+	push <- `{"type":"ready"}`
+	close(push)
+
+	select {
+	case data := <-got:
+		assert.JSONEq(t, `{"type":"ready"}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for WaitFor")
+	}
+	// the messages before went to OnMessage
+	assert.JSONEq(t, `{"type":"progress","pct":50}`, <-others)
+	assert.JSONEq(t, `{"type":"progress","pct":100}`, <-others)
+}
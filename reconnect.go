@@ -0,0 +1,282 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReconnectConfig controls automatic reconnection after a connection is lost.
+// The delay before each attempt starts at InitialDelay and doubles after every
+// failed attempt, up to MaxDelay, unless another schedule is set with
+// WithBackoff. A Retry-After header in the response to a
+// failed handshake, e.g. with status 429 or 503, makes the next delay as long
+// as the server asked for, even past MaxDelay.
+type ReconnectConfig struct {
+	// InitialDelay is the delay before the first attempt (default 1s)
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts (default 30s)
+	MaxDelay time.Duration
+	// MaxAttempts is the number of attempts before giving up, 0 for no limit
+	MaxAttempts int
+	// MaxElapsed is how long to keep trying after the connection was lost
+	// before giving up, 0 for no limit. It composes with MaxAttempts:
+	// whichever is reached first ends reconnection.
+	MaxElapsed time.Duration
+	// RetryStatus decides from the HTTP status of the response to a failed
+	// handshake whether to keep trying, e.g. DefaultRetryStatus. Returning
+	// false gives up right away. nil retries any status. Failures without
+	// a response, such as a refused connection, are always retried. If it
+	// is set, it applies to the dial of Open as well: a status it accepts
+	// is retried with the same backoff within the context of Open, while
+	// the other failures are returned right away.
+	RetryStatus func(status int) bool
+}
+
+// DefaultRetryStatus is a ReconnectConfig.RetryStatus that retries the
+// statuses a server returns while overloaded or being deployed, 5xx, 408
+// and 429, and gives up on the other statuses, such as 401 or 403, which
+// are not going to change by trying again.
+func DefaultRetryStatus(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests
+}
+
+const (
+	defaultReconnectInitialDelay = 1 * time.Second
+	defaultReconnectMaxDelay     = 30 * time.Second
+)
+
+// WithReconnect enables automatic reconnection when the connection to the
+// server is lost. A connection closed by calling Close is never re-established.
+func WithReconnect(cfg ReconnectConfig) Option {
+	return func(c *WSClient) {
+		if cfg.InitialDelay <= 0 {
+			cfg.InitialDelay = defaultReconnectInitialDelay
+		}
+		if cfg.MaxDelay <= 0 {
+			cfg.MaxDelay = defaultReconnectMaxDelay
+		}
+		if cfg.MaxDelay < cfg.InitialDelay {
+			cfg.MaxDelay = cfg.InitialDelay
+		}
+		c.reconnect = &cfg
+	}
+}
+
+// OnReconnect is the callback function when the connection is re-established
+// after it was lost
+func (c *WSClient) OnReconnect(fn func()) {
+	c.callbacksMu.Lock()
+	c.cb.onReconnect = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnGiveUp is the callback function when reconnection stops after
+// ReconnectConfig.MaxAttempts failed attempts, once ReconnectConfig.MaxElapsed
+// has passed or when ReconnectConfig.RetryStatus rejects the status of a
+// failed handshake. It receives the last dial error. The client is closed
+// afterwards.
+func (c *WSClient) OnGiveUp(fn func(err error)) {
+	c.callbacksMu.Lock()
+	c.cb.onGiveUp = fn
+	c.callbacksMu.Unlock()
+}
+
+// Reconnect replaces the open connection with a new one, e.g. when the
+// application knows the connection is stale after waking from sleep. The
+// current connection is closed with a normal close frame, then the server
+// is dialed right away, without the backoff of automatic reconnection, and
+// OnReconnect is called once connected. Sends fail with ErrReconnecting in
+// the meantime, unless the outbox is enabled, see WithOutbox.
+//
+// Reconnect returns ErrNotConnected if there is no open connection, and the
+// dial error if the server cannot be reached, in which case automatic
+// reconnection takes over if enabled, see WithReconnect, and the client is
+// closed otherwise.
+func (c *WSClient) Reconnect() error {
+	old := c.currentConn()
+	if old == nil || !c.retire(old) {
+		return ErrNotConnected
+	}
+	if c.outboxSize > 0 {
+		c.setOffline(true)
+	}
+	c.setState(StateReconnecting)
+	// the writer must have stopped before the next one starts, so that the
+	// messages keep their order
+	<-old.writeDone
+	c.closeConn(old)
+
+	if fn := c.callbacks().onConnecting; fn != nil {
+		fn()
+	}
+	ctx, cancel := c.contextUntil(context.Background(), old.closing)
+	defer cancel()
+	ws, resp, err := c.dial(ctx)
+	if err != nil {
+		if isDone(old.closing) {
+			return ErrClosed
+		}
+		c.logf("reconnect: %s", err.Error())
+		c.setState(StateDisconnected)
+		if c.reconnect == nil {
+			c.Close()
+		} else {
+			c.goroutine(func() { c.reconnectLoop(old.closing) })
+		}
+		return err
+	}
+	if !c.start(ws, resp, old.closing) {
+		return ErrClosed
+	}
+	if err := c.reconnectReady(ctx); err != nil {
+		return err
+	}
+	if fn := c.callbacks().onReconnect; fn != nil {
+		fn()
+	}
+	return nil
+}
+
+// reconnectLoop re-establishes the connection until it succeeds, the policy
+// gives up or done, the client's done channel when the connection was lost,
+// is closed
+func (c *WSClient) reconnectLoop(done chan struct{}) {
+	ctx, cancel := c.contextUntil(context.Background(), done)
+	defer cancel()
+
+	cfg := c.reconnect
+	backoff := c.reconnectBackoff()
+	lost := time.Now()
+	var lastErr error
+	var after time.Duration
+	attempt := 1
+	for ; cfg.MaxAttempts == 0 || attempt <= cfg.MaxAttempts; attempt++ {
+		wait := backoff.NextDelay(attempt)
+		if after > wait {
+			// the server asked to wait longer, see retryAfter
+			wait = after
+		}
+		if cfg.MaxElapsed > 0 {
+			remaining := cfg.MaxElapsed - time.Since(lost)
+			if remaining <= 0 {
+				break
+			}
+			// make the last attempt at the end of the budget rather than
+			// waiting past it
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+
+		c.setState(StateBackingOff)
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return
+		}
+
+		c.setState(StateReconnecting)
+		if fn := c.callbacks().onConnecting; fn != nil {
+			fn()
+		}
+		ws, resp, err := c.dial(ctx)
+		if err == nil {
+			backoff.Reset()
+			if c.start(ws, resp, done) && c.reconnectReady(ctx) == nil {
+				if fn := c.callbacks().onReconnect; fn != nil {
+					fn()
+				}
+			}
+			return
+		}
+		if isDone(done) {
+			return
+		}
+		c.logf("reconnect: attempt %d: %s", attempt, err.Error())
+		c.reportError(err)
+		lastErr = err
+		if resp != nil && cfg.RetryStatus != nil && !cfg.RetryStatus(resp.StatusCode) {
+			c.logf("reconnect: not retrying status %d", resp.StatusCode)
+			attempt++
+			break
+		}
+		after = retryAfter(resp)
+	}
+
+	c.logf("reconnect: giving up after %d attempts in %s", attempt-1, time.Since(lost))
+	c.connMu.Lock()
+	c.giveUpErr = lastErr
+	c.connMu.Unlock()
+	if fn := c.callbacks().onGiveUp; fn != nil {
+		fn(lastErr)
+	}
+	c.Close()
+}
+
+// dialRetrying dials for Open. With WithReconnect, a handshake refused with a
+// status accepted by ReconnectConfig.RetryStatus is retried with the backoff
+// of reconnection, honoring Retry-After, until ctx is done or the limits of
+// the policy are reached.
+func (c *WSClient) dialRetrying(ctx context.Context) (*websocket.Conn, *http.Response, error) {
+	ws, resp, err := c.dial(ctx)
+	cfg := c.reconnect
+	if err == nil || cfg == nil || cfg.RetryStatus == nil {
+		return ws, resp, err
+	}
+	backoff := c.reconnectBackoff()
+	start := time.Now()
+	for attempt := 1; cfg.MaxAttempts == 0 || attempt <= cfg.MaxAttempts; attempt++ {
+		if resp == nil || !cfg.RetryStatus(resp.StatusCode) {
+			break
+		}
+		wait := backoff.NextDelay(attempt)
+		if after := retryAfter(resp); after > wait {
+			wait = after
+		}
+		if cfg.MaxElapsed > 0 && time.Since(start)+wait > cfg.MaxElapsed {
+			break
+		}
+		c.logf("dial: status %d, retrying in %s", resp.StatusCode, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		}
+
+		if fn := c.callbacks().onConnecting; fn != nil {
+			fn()
+		}
+		ws, resp, err = c.dial(ctx)
+		if err == nil {
+			backoff.Reset()
+			return ws, resp, nil
+		}
+	}
+	return nil, resp, err
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of resp,
+// in seconds or as a date, 0 if there is none
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,790 @@
+package wsclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchState(t *testing.T) {
+	var conns int32
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&conns, 1) == 1 {
+			// drop the first connection right away
+			return
+		}
+		<-release
+	})
+
+	reconnected := make(chan bool)
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{
+		InitialDelay: 10 * time.Millisecond,
+	}))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	states := ws.WatchState()
+	ws.Connect()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	ws.Close()
+
+	var got []State
+	for s := range states {
+		got = append(got, s)
+	}
+	assert.Equal(t, []State{
+		StateConnecting,
+		StateConnected,
+		StateDisconnected,
+		StateBackingOff,
+		StateReconnecting,
+		StateConnected,
+		StateClosed,
+	}, got)
+}
+
+// newFlakyServer starts a server that accepts the first connection and drops
+// it right away, then refuses every later connection. It returns the ws://
+// URL and a counter of the connection attempts.
+func newFlakyServer(t *testing.T) (string, *int32) {
+	var conns int32
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&conns, 1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http"), &conns
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	u, conns := newFlakyServer(t)
+
+	gaveUp := make(chan error, 1)
+	closed := make(chan bool, 1)
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{
+		InitialDelay: 10 * time.Millisecond,
+		MaxAttempts:  2,
+	}))
+	ws.OnGiveUp(func(err error) {
+		gaveUp <- err
+	})
+	ws.OnClose(func() {
+		closed <- true
+	})
+	ws.Connect()
+
+	select {
+	case err := <-gaveUp:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for give up")
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for close")
+	}
+	assert.Equal(t, StateClosed, ws.State())
+	assert.Equal(t, int32(3), atomic.LoadInt32(conns))
+}
+
+func TestReconnectMaxElapsed(t *testing.T) {
+	u, _ := newFlakyServer(t)
+
+	const maxElapsed = 300 * time.Millisecond
+	gaveUp := make(chan time.Time, 1)
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{
+		InitialDelay: 20 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+		MaxElapsed:   maxElapsed,
+	}))
+	ws.OnGiveUp(func(err error) {
+		gaveUp <- time.Now()
+	})
+	states := ws.WatchState()
+	ws.Connect()
+
+	var lost time.Time
+	for s := range states {
+		if s == StateDisconnected {
+			lost = time.Now()
+			break
+		}
+	}
+	select {
+	case at := <-gaveUp:
+		elapsed := at.Sub(lost)
+		assert.True(t, elapsed >= maxElapsed, "gave up after %s", elapsed)
+		assert.True(t, elapsed < maxElapsed+200*time.Millisecond, "gave up after %s", elapsed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for give up")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestShutdownAfterReconnect(t *testing.T) {
+	var conns int32
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&conns, 1) == 1 {
+			return
+		}
+		<-release
+	})
+
+	reconnected := make(chan bool)
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{
+		InitialDelay: 10 * time.Millisecond,
+	}))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ws.Connect()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	ws.Close()
+	waitShutdown(t, ws)
+}
+
+func TestShutdownDuringBackoff(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {})
+
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{
+		InitialDelay: time.Hour,
+	}))
+	states := ws.WatchState()
+	ws.Connect()
+	for s := range states {
+		if s == StateBackingOff {
+			break
+		}
+	}
+	ws.Close()
+	waitShutdown(t, ws)
+}
+
+func TestSetURL(t *testing.T) {
+	drop := make(chan bool)
+	u1 := newTestServer(t, func(conn *websocket.Conn) {
+		<-drop
+	})
+	release := make(chan bool)
+	defer close(release)
+	accepted := make(chan bool, 1)
+	u2 := newTestServer(t, func(conn *websocket.Conn) {
+		accepted <- true
+		<-release
+	})
+
+	reconnected := make(chan bool)
+	ws := NewWSClient(u1, WithReconnect(ReconnectConfig{
+		InitialDelay: 10 * time.Millisecond,
+	}))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	ws.SetURL(u2)
+	assert.Equal(t, u2, ws.URL())
+	close(drop)
+
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection to new URL")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+}
+
+func TestHeaderFunc(t *testing.T) {
+	var conns int32
+	tokens := make(chan string, 2)
+	release := make(chan bool)
+	defer close(release)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens <- r.Header.Get("Authorization")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if atomic.AddInt32(&conns, 1) > 1 {
+			<-release
+		}
+	}))
+	defer s.Close()
+
+	// the second call fails, which counts as a failed reconnection attempt
+	var calls int32
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond}),
+		WithHeaderFunc(func() (http.Header, error) {
+			n := atomic.AddInt32(&calls, 1)
+			if n == 2 {
+				return nil, errors.New("token service unavailable")
+			}
+			return http.Header{"Authorization": {fmt.Sprintf("Bearer token-%d", n)}}, nil
+		}))
+	reconnected := make(chan bool)
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	assert.Equal(t, "Bearer token-1", <-tokens)
+	assert.Equal(t, "Bearer token-3", <-tokens)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestHandshakeSigner(t *testing.T) {
+	sign := func(key, timestamp, nonce, path string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		fmt.Fprintf(mac, "%s\n%s\n%s", timestamp, nonce, path)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := sign("secret", r.Header.Get("X-Timestamp"), r.Header.Get("X-Nonce"), r.URL.Path)
+		if !hmac.Equal([]byte(want), []byte(r.Header.Get("X-Signature"))) || r.Header.Get("X-Client") != "test" {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	defer s.Close()
+
+	var nonce int32
+	open := func(key string) error {
+		ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http")+"/feed",
+			WithHeaderFunc(func() (http.Header, error) {
+				return http.Header{"X-Client": {"test"}}, nil
+			}),
+			WithHandshakeSigner(func(req *http.Request) error {
+				timestamp := fmt.Sprint(time.Now().Unix())
+				n := fmt.Sprint(atomic.AddInt32(&nonce, 1))
+				req.Header.Set("X-Timestamp", timestamp)
+				req.Header.Set("X-Nonce", n)
+				req.Header.Set("X-Signature", sign(key, timestamp, n, req.URL.Path))
+				return nil
+			}))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := ws.Open(ctx)
+		if err == nil {
+			ws.Close()
+			waitShutdown(t, ws)
+		}
+		return err
+	}
+
+	assert.NoError(t, open("secret"))
+	err := open("wrong")
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+	var he *HandshakeError
+	if assert.ErrorAs(t, err, &he) {
+		assert.Equal(t, http.StatusUnauthorized, he.StatusCode)
+	}
+}
+
+func TestSendReconnecting(t *testing.T) {
+	var conns int32
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		// drop the first connection right away
+		if atomic.AddInt32(&conns, 1) > 1 {
+			<-release
+		}
+	})
+
+	ws := NewWSClient(u,
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{InitialDelay: 500 * time.Millisecond}))
+	reconnected := make(chan bool)
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	states := ws.WatchState()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for s := range states {
+		if s == StateBackingOff {
+			break
+		}
+	}
+	assert.Equal(t, ErrReconnecting, ws.SendJSON(M{"op": "hello"}))
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	assert.NoError(t, ws.SendJSON(M{"op": "hello"}))
+}
+
+func TestManualReconnect(t *testing.T) {
+	var conns int32
+	closeErrs := make(chan error, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		n := atomic.AddInt32(&conns, 1)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				closeErrs <- err
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("%d:%s", n, data)))
+		}
+	})
+
+	reconnected := make(chan bool, 1)
+	received := make(chan string, 1)
+	ws := NewWSClient(u)
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ws.OnMessage(func(data []byte) {
+		received <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	id := ws.Stats().ConnID
+
+	assert.NoError(t, ws.Reconnect())
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnReconnect")
+	}
+	assert.Equal(t, id+1, ws.Stats().ConnID)
+	assert.Equal(t, StateConnected, ws.State())
+	// the old connection was closed normally
+	err := <-closeErrs
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+
+	assert.NoError(t, ws.SendText("hello"))
+	select {
+	case data := <-received:
+		assert.Equal(t, "2:hello", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+
+	assert.Equal(t, ErrNotConnected, NewWSClient(u).Reconnect())
+}
+
+func TestIsReconnecting(t *testing.T) {
+	var conns int32
+	release := make(chan bool)
+	defer close(release)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&conns, 1)
+		if n == 2 || n == 3 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if n > 1 {
+			<-release
+		}
+	}))
+	defer s.Close()
+
+	reconnected := make(chan bool)
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{InitialDelay: 20 * time.Millisecond}))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	states := ws.WatchState()
+	assert.False(t, ws.IsReconnecting())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for s := range states {
+		if s == StateBackingOff {
+			break
+		}
+	}
+	assert.True(t, ws.IsReconnecting())
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	assert.False(t, ws.IsReconnecting())
+	assert.EqualValues(t, 4, atomic.LoadInt32(&conns))
+}
+
+func TestReconnectAfterWriteError(t *testing.T) {
+	var conns int32
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		// never read, so that large writes stall
+		atomic.AddInt32(&conns, 1)
+		<-release
+	})
+
+	reconnected := make(chan bool)
+	lost := make(chan DisconnectInfo, 1)
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithCloseTimeout(0),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond}))
+	ws.OnDisconnect(func(info DisconnectInfo) {
+		select {
+		case lost <- info:
+		default:
+		}
+	})
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// too large for the socket buffers, so the write stalls and times out
+	payload := make([]byte, 32<<20)
+	deadline := time.Now().Add(100 * time.Millisecond)
+	assert.NoError(t, ws.SendRawWithDeadline(websocket.BinaryMessage, payload, deadline))
+
+	select {
+	case info := <-lost:
+		assert.False(t, info.UserInitiated)
+		var netErr net.Error
+		if assert.ErrorAs(t, info.Err, &netErr) {
+			assert.True(t, netErr.Timeout())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection to be lost")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	assert.Equal(t, StateConnected, ws.State())
+	assert.EqualValues(t, 2, atomic.LoadInt32(&conns))
+}
+
+func TestWaitState(t *testing.T) {
+	var down int32
+	kick := make(chan bool)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		select {
+		case <-kick:
+		case <-r.Context().Done():
+		}
+	}))
+	defer s.Close()
+
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond, MaxDelay: 20 * time.Millisecond}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	assert.NoError(t, ws.WaitState(ctx, StateConnected))
+
+	atomic.StoreInt32(&down, 1)
+	kick <- true
+	assert.NoError(t, ws.WaitState(ctx, StateReconnecting))
+
+	atomic.StoreInt32(&down, 0)
+	assert.NoError(t, ws.WaitState(ctx, StateConnected))
+	assert.Equal(t, StateConnected, ws.State())
+
+	short, cancelShort := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelShort()
+	assert.Equal(t, context.DeadlineExceeded, ws.WaitState(short, StateReconnecting))
+
+	ws.Close()
+	assert.NoError(t, ws.WaitState(ctx, StateClosed))
+	assert.Equal(t, ErrClosed, ws.WaitState(ctx, StateConnected))
+}
+
+func TestReconnectRetryAfter(t *testing.T) {
+	var conns int32
+	attempts := make(chan time.Time, 3)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&conns, 1)
+		if n > 1 {
+			attempts <- time.Now()
+		}
+		if n == 2 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if n == 1 {
+			// drop the first connection right away
+			return
+		}
+		conn.ReadMessage()
+	}))
+	defer s.Close()
+
+	reconnected := make(chan bool)
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{
+			InitialDelay: 10 * time.Millisecond,
+			MaxDelay:     20 * time.Millisecond,
+			RetryStatus:  DefaultRetryStatus,
+		}))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	limited, retried := <-attempts, <-attempts
+	assert.True(t, retried.Sub(limited) >= time.Second, "retried after %s", retried.Sub(limited))
+}
+
+func TestReconnectRetryStatus(t *testing.T) {
+	var conns int32
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&conns, 1) > 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer s.Close()
+
+	gaveUp := make(chan error, 1)
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{
+			InitialDelay: 10 * time.Millisecond,
+			RetryStatus:  DefaultRetryStatus,
+		}))
+	ws.OnGiveUp(func(err error) {
+		gaveUp <- err
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	select {
+	case err := <-gaveUp:
+		var he *HandshakeError
+		if assert.ErrorAs(t, err, &he) {
+			assert.Equal(t, http.StatusUnauthorized, he.StatusCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting to give up")
+	}
+	assert.NoError(t, ws.WaitState(ctx, StateClosed))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&conns))
+}
+
+func TestDefaultRetryStatus(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusServiceUnavailable: true,
+		http.StatusBadGateway:         true,
+		http.StatusTooManyRequests:    true,
+		http.StatusRequestTimeout:     true,
+		http.StatusUnauthorized:       false,
+		http.StatusForbidden:          false,
+		http.StatusNotFound:           false,
+	} {
+		assert.Equal(t, want, DefaultRetryStatus(status), status)
+	}
+}
+
+func TestOpenRetryStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		conns  int32
+	}{
+		{"retried", http.StatusServiceUnavailable, 2},
+		{"not retried", http.StatusUnauthorized, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var conns int32
+			attempts := make(chan time.Time, 2)
+			upgrader := websocket.Upgrader{}
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts <- time.Now()
+				if atomic.AddInt32(&conns, 1) == 1 {
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "deploying", tc.status)
+					return
+				}
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.ReadMessage()
+			}))
+			defer s.Close()
+
+			ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+				WithLogger(discardLogger{}),
+				WithReconnect(ReconnectConfig{
+					InitialDelay: 10 * time.Millisecond,
+					RetryStatus:  DefaultRetryStatus,
+				}))
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := ws.Open(ctx)
+			assert.Equal(t, tc.conns, atomic.LoadInt32(&conns))
+			if tc.conns == 1 {
+				var he *HandshakeError
+				if assert.ErrorAs(t, err, &he) {
+					assert.Equal(t, tc.status, he.StatusCode)
+				}
+				waitShutdown(t, ws)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			refused, retried := <-attempts, <-attempts
+			assert.True(t, retried.Sub(refused) >= time.Second, "retried after %s", retried.Sub(refused))
+			ws.Close()
+			waitShutdown(t, ws)
+		})
+	}
+}
+
+func TestOpenRetryStatusContext(t *testing.T) {
+	var conns int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&conns, 1)
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"),
+		WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{RetryStatus: DefaultRetryStatus}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// the wait asked for by the server ends with the context of Open
+	assert.Equal(t, context.DeadlineExceeded, ws.Open(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+	waitShutdown(t, ws)
+}
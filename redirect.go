@@ -0,0 +1,111 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrTooManyRedirects is returned when the server redirects the
+	// handshake more often than allowed by WithMaxRedirects
+	ErrTooManyRedirects = errors.New("wsclient: too many redirects")
+	// ErrInsecureRedirect is returned when the server redirects the
+	// handshake from a wss URL to a ws URL
+	ErrInsecureRedirect = errors.New("wsclient: redirect from wss to ws")
+)
+
+// WithMaxRedirects makes the client follow up to n redirects answered by
+// the server to the handshake, to the ws or wss URL of the Location header.
+// By default redirects are not followed and the dial fails with a
+// HandshakeError. A redirect from wss to ws fails with
+// ErrInsecureRedirect, more than n redirects with ErrTooManyRedirects.
+//
+// The headers of WithHeaderFunc and WithHandshakeSigner are sent to the
+// redirect target too. The URL set with SetURL is not changed: every
+// reconnection starts over from it, see FinalURL for where the client
+// ended up.
+func WithMaxRedirects(n int) Option {
+	return func(c *WSClient) {
+		c.maxRedirects = n
+	}
+}
+
+// FinalURL returns the URL of the server the client last connected to,
+// after following redirects, see WithMaxRedirects. It returns an empty
+// string if the client never connected.
+func (c *WSClient) FinalURL() string {
+	c.uMu.RLock()
+	defer c.uMu.RUnlock()
+	return c.finalURL
+}
+
+// dialURL performs the WebSocket handshake with the server at u, following
+// the redirects allowed by WithMaxRedirects
+func (c *WSClient) dialURL(ctx context.Context, u string) (*websocket.Conn, *http.Response, error) {
+	for redirects := 0; ; redirects++ {
+		ws, resp, err := c.dialOnce(ctx, u)
+		if err == nil {
+			c.uMu.Lock()
+			c.finalURL = u
+			c.uMu.Unlock()
+			return ws, resp, nil
+		}
+		if c.maxRedirects == 0 || !isRedirect(resp) {
+			return nil, resp, handshakeError(resp, err)
+		}
+		if redirects == c.maxRedirects {
+			return nil, resp, ErrTooManyRedirects
+		}
+		next, rerr := redirectURL(u, resp.Header.Get("Location"))
+		if rerr != nil {
+			return nil, resp, rerr
+		}
+		c.logf("dial: redirected from %s to %s", u, next)
+		u = next
+	}
+}
+
+// isRedirect tells whether resp is a redirect with a target
+func isRedirect(resp *http.Response) bool {
+	if resp == nil || resp.Header.Get("Location") == "" {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectURL resolves the Location of a redirect from u. An http or https
+// location is taken as ws or wss.
+func redirectURL(u, location string) (string, error) {
+	base, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("wsclient: invalid redirect location %q: %w", location, err)
+	}
+	next := base.ResolveReference(ref)
+	switch next.Scheme {
+	case "http":
+		next.Scheme = "ws"
+	case "https":
+		next.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", fmt.Errorf("wsclient: invalid redirect location %q", location)
+	}
+	if base.Scheme == "wss" && next.Scheme == "ws" {
+		return "", ErrInsecureRedirect
+	}
+	return next.String(), nil
+}
@@ -0,0 +1,82 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxRedirects(t *testing.T) {
+	target := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http"+strings.TrimPrefix(target, "ws"), http.StatusTemporaryRedirect)
+	}))
+	defer s.Close()
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	t.Run("not followed", func(t *testing.T) {
+		ws := NewWSClient(u, WithLogger(discardLogger{}))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := ws.Open(ctx)
+		assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+		var he *HandshakeError
+		if assert.ErrorAs(t, err, &he) {
+			assert.Equal(t, http.StatusTemporaryRedirect, he.StatusCode)
+		}
+		assert.Equal(t, "", ws.FinalURL())
+	})
+
+	t.Run("followed", func(t *testing.T) {
+		ws := NewWSClient(u, WithLogger(discardLogger{}), WithMaxRedirects(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if !assert.NoError(t, ws.Open(ctx)) {
+			return
+		}
+		defer ws.Close()
+		assert.Equal(t, target, ws.FinalURL())
+		assert.Equal(t, u, ws.URL())
+	})
+
+	t.Run("too many", func(t *testing.T) {
+		loop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		}))
+		defer loop.Close()
+		ws := NewWSClient("ws"+strings.TrimPrefix(loop.URL, "http"), WithLogger(discardLogger{}), WithMaxRedirects(2))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.Equal(t, ErrTooManyRedirects, ws.Open(ctx))
+	})
+}
+
+func TestRedirectURL(t *testing.T) {
+	for _, tc := range []struct {
+		u, location, want string
+		err               error
+	}{
+		{"ws://a/x", "ws://b/y", "ws://b/y", nil},
+		{"ws://a/x", "/y", "ws://a/y", nil},
+		{"wss://a/x", "https://b/y", "wss://b/y", nil},
+		{"ws://a/x", "wss://b/y", "wss://b/y", nil},
+		{"wss://a/x", "ws://b/y", "", ErrInsecureRedirect},
+		{"wss://a/x", "http://b/y", "", ErrInsecureRedirect},
+	} {
+		got, err := redirectURL(tc.u, tc.location)
+		assert.Equal(t, tc.err, err, tc.location)
+		assert.Equal(t, tc.want, got, tc.location)
+	}
+}
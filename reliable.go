@@ -0,0 +1,187 @@
+package wsclient
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SeqField is the field of the outbound JSON messages that carries the
+// sequence number assigned with WithReliableDelivery
+const SeqField = "seq"
+
+// reliableDelivery tracks the messages sent with WithReliableDelivery until
+// the server acknowledges them
+type reliableDelivery struct {
+	ackField string
+	next     uint64
+	pending  map[uint64]*unacked
+	mu       sync.Mutex
+}
+
+// unacked is a message that was not acknowledged yet
+type unacked struct {
+	mt   int
+	data []byte
+	sent time.Time
+	// written is set once the message was handed to a connection, whether
+	// the write succeeded or not
+	written bool
+}
+
+// WithReliableDelivery numbers the JSON messages sent to the server, from 1
+// in the SeqField field, and tracks them until the server acknowledges them
+// with a message whose ackField holds the sequence number, e.g.
+// {"seq":7,...} is acknowledged with {"ack":7} for ackField "ack". The
+// acknowledgments are passed to OnMessage like any other message. See
+// PendingAcks and ResendUnacked.
+//
+// The messages written to a connection that ends before they are
+// acknowledged are written again, in order, when the client reconnects,
+// ahead of the outbox and of any later message. Delivery is thus at least
+// once: a message received by the server whose ack was lost with the
+// connection is received twice, so the server must drop duplicates, e.g. by
+// remembering the last sequence number it processed.
+func WithReliableDelivery(ackField string) Option {
+	return func(c *WSClient) {
+		c.reliable = &reliableDelivery{
+			ackField: ackField,
+			pending:  make(map[uint64]*unacked),
+		}
+	}
+}
+
+// PendingAcks returns the sequence numbers of the messages that were sent
+// but not acknowledged by the server yet, in increasing order. It returns nil
+// without WithReliableDelivery.
+func (c *WSClient) PendingAcks() []uint64 {
+	if c.reliable == nil {
+		return nil
+	}
+	r := c.reliable
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seqs := make([]uint64, 0, len(r.pending))
+	for seq := range r.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// ResendUnacked sends again, as they were first sent and in order, the
+// messages that have not been acknowledged within olderThan. It returns the
+// number of messages resent, and stops at the first send error.
+func (c *WSClient) ResendUnacked(olderThan time.Duration) (int, error) {
+	if c.reliable == nil {
+		return 0, nil
+	}
+	r := c.reliable
+	type resend struct {
+		seq uint64
+		m   *unacked
+	}
+	var due []resend
+	now := time.Now()
+	r.mu.Lock()
+	for seq, m := range r.pending {
+		if now.Sub(m.sent) >= olderThan {
+			m.sent = now
+			due = append(due, resend{seq, m})
+		}
+	}
+	r.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].seq < due[j].seq })
+
+	for i, d := range due {
+		// the frame is sent as is: it went through the enricher and the
+		// middleware already
+		if err := c.enqueue(&message{mt: d.m.mt, data: d.m.data}); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// tag returns a copy of j with the next sequence number
+func (r *reliableDelivery) tag(j M) (M, uint64) {
+	r.mu.Lock()
+	r.next++
+	seq := r.next
+	r.mu.Unlock()
+
+	tagged := make(M, len(j)+1)
+	for k, v := range j {
+		tagged[k] = v
+	}
+	tagged[SeqField] = seq
+	return tagged, seq
+}
+
+// track records the encoded message with sequence number seq
+func (r *reliableDelivery) track(seq uint64, mt int, data []byte) {
+	m := &unacked{mt: mt, data: append([]byte(nil), data...), sent: time.Now()}
+	r.mu.Lock()
+	r.pending[seq] = m
+	r.mu.Unlock()
+}
+
+// written marks the message with sequence number seq as written to a
+// connection
+func (r *reliableDelivery) written(seq uint64) {
+	r.mu.Lock()
+	if m, ok := r.pending[seq]; ok {
+		m.written = true
+		m.sent = time.Now()
+	}
+	r.mu.Unlock()
+}
+
+// replayUnacked writes to conn, in order, the messages that were written to
+// an earlier connection and not acknowledged
+func (c *WSClient) replayUnacked(conn *connection) error {
+	r := c.reliable
+	var seqs []uint64
+	r.mu.Lock()
+	for seq, m := range r.pending {
+		if m.written {
+			seqs = append(seqs, seq)
+		}
+	}
+	msgs := make([]*message, len(seqs))
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for i, seq := range seqs {
+		m := r.pending[seq]
+		msgs[i] = &message{mt: m.mt, data: m.data, seq: seq}
+	}
+	r.mu.Unlock()
+
+	if len(msgs) > 0 {
+		c.logf("reliable: resending %d unacknowledged messages", len(msgs))
+	}
+	for _, m := range msgs {
+		if err := c.writeMessage(conn, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forget stops tracking the message with sequence number seq
+func (r *reliableDelivery) forget(seq uint64) {
+	r.mu.Lock()
+	delete(r.pending, seq)
+	r.mu.Unlock()
+}
+
+// handleAck forgets the message acknowledged by data, if it is an ack
+func (r *reliableDelivery) handleAck(data []byte) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	if seq, ok := fields[r.ackField].(float64); ok && seq >= 1 {
+		r.forget(uint64(seq))
+	}
+}
@@ -0,0 +1,152 @@
+package wsclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReliableDelivery(t *testing.T) {
+	seqs := make(chan uint64, 10)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			var m struct {
+				Seq uint64 `json:"seq"`
+			}
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			seqs <- m.Seq
+			// only the odd messages are acknowledged
+			if m.Seq%2 == 1 {
+				conn.WriteJSON(M{"ack": m.Seq})
+			}
+		}
+	})
+
+	acks := make(chan bool, 10)
+	ws := NewWSClient(u, WithReliableDelivery("ack"))
+	ws.OnMessage(func(data []byte) {
+		acks <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	msg := M{"op": "event"}
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, ws.SendJSON(msg))
+	}
+	_, tagged := msg[SeqField]
+	assert.False(t, tagged, "the caller's message was modified")
+	for i := uint64(1); i <= 4; i++ {
+		assert.Equal(t, i, <-seqs)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-acks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ack")
+		}
+	}
+	assert.Equal(t, []uint64{2, 4}, ws.PendingAcks())
+
+	// nothing is old enough yet
+	n, err := ws.ResendUnacked(time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = ws.ResendUnacked(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, uint64(2), <-seqs)
+	assert.Equal(t, uint64(4), <-seqs)
+	assert.Equal(t, []uint64{2, 4}, ws.PendingAcks())
+}
+
+func TestReliableDeliveryNotSent(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082", WithReliableDelivery("ack"))
+	assert.Equal(t, ErrNotConnected, ws.SendJSON(M{"op": "event"}))
+	assert.Empty(t, ws.PendingAcks())
+	assert.Nil(t, NewWSClient("ws://localhost:8082").PendingAcks())
+}
+
+func TestReliableDeliveryReconnect(t *testing.T) {
+	var conns int32
+	seqs := make(chan uint64, 10)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		first := atomic.AddInt32(&conns, 1) == 1
+		for i := 0; ; i++ {
+			var m struct {
+				Seq uint64 `json:"seq"`
+			}
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			if first {
+				// acknowledge the first message only, then drop the
+				// connection with the others in flight
+				if i == 0 {
+					conn.WriteJSON(M{"ack": m.Seq})
+				}
+				if i == 2 {
+					return
+				}
+				continue
+			}
+			seqs <- m.Seq
+			conn.WriteJSON(M{"ack": m.Seq})
+		}
+	})
+
+	acked := make(chan bool, 10)
+	reconnected := make(chan bool, 1)
+	ws := NewWSClient(u,
+		WithLogger(discardLogger{}),
+		WithReliableDelivery("ack"),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond}))
+	ws.OnMessage(func(data []byte) {
+		acked <- true
+	})
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// wait for the first ack so that only 2 and 3 are in flight
+	assert.NoError(t, ws.SendJSON(M{"n": 1}))
+	<-acked
+	assert.NoError(t, ws.SendJSON(M{"n": 2}))
+	assert.NoError(t, ws.SendJSON(M{"n": 3}))
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+	assert.NoError(t, ws.SendJSON(M{"n": 4}))
+
+	// the unacknowledged messages are resent ahead of the new one
+	for want := uint64(2); want <= 4; want++ {
+		select {
+		case seq := <-seqs:
+			assert.Equal(t, want, seq)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+	assert.Eventually(t, func() bool {
+		return len(ws.PendingAcks()) == 0
+	}, 5*time.Second, time.Millisecond)
+}
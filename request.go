@@ -0,0 +1,290 @@
+package wsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// ErrTooManyPending is returned by SendAndWait when the limit set with
+// WithMaxPendingRequests is reached and the policy is PendingFail
+var ErrTooManyPending = errors.New("wsclient: too many pending requests")
+
+// PendingPolicy decides what SendAndWait does when the limit set with
+// WithMaxPendingRequests is reached
+type PendingPolicy int
+
+const (
+	// PendingBlock makes SendAndWait wait until a pending request completes
+	// or its context is done
+	PendingBlock PendingPolicy = iota
+	// PendingFail makes SendAndWait fail right away with ErrTooManyPending
+	PendingFail
+)
+
+// WithMaxPendingRequests limits the number of SendAndWait calls waiting for a
+// response at the same time to n. policy decides what happens to calls made
+// while the limit is reached. n <= 0 removes the limit.
+func WithMaxPendingRequests(n int, policy PendingPolicy) Option {
+	return func(c *WSClient) {
+		if n <= 0 {
+			c.pendingSlots = nil
+			return
+		}
+		c.pendingSlots = make(chan struct{}, n)
+		c.pendingPolicy = policy
+	}
+}
+
+// withRequestID returns a copy of req carrying its id in idField, a new one
+// if req has none, and the key of the pending request
+func (c *WSClient) withRequestID(req M, idField string) (M, string) {
+	msg := make(M, len(req)+1)
+	for k, v := range req {
+		msg[k] = v
+	}
+	id, ok := msg[idField]
+	if !ok {
+		id = c.newID()
+		msg[idField] = id
+	}
+	return msg, idKey(id)
+}
+
+// idKey returns the key matching the id of a request with the id of its
+// responses, decoded with UseNumber: the string itself for a string, the
+// JSON encoding otherwise, so that e.g. a request id of 1000000 matches a
+// response id of 1000000 or 1e6
+func idKey(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		if f, err := v.Float64(); err == nil {
+			id = f
+		}
+	}
+	b, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Sprint(id)
+	}
+	return string(b)
+}
+
+// pendingRequest is a SendAndWait or SendAndWaitAll call waiting for its
+// responses
+type pendingRequest struct {
+	field string
+	resp  chan []byte
+	// all is set for SendAndWaitAll, which takes several responses until
+	// done is closed
+	all  bool
+	done chan struct{}
+}
+
+// SendAndWait sends req to the server and blocks until a response carrying the
+// same value in idField arrives, or ctx is done. If req has no idField, a
+// unique id is generated and set on the message sent, see WithIDGenerator;
+// req itself is not modified and may be nil. The response is returned to the
+// caller and not passed to OnMessage.
+//
+// The pending request is removed when SendAndWait returns, whatever the
+// outcome. A response that arrives after that is delivered to OnMessage like
+// any other message.
+func (c *WSClient) SendAndWait(ctx context.Context, req M, idField string) (data []byte, err error) {
+	req, key := c.withRequestID(req, idField)
+
+	if c.tracer != nil {
+		var span Span
+		ctx, span = c.startRequestSpan(ctx, req)
+		defer func() { span.End(err) }()
+	}
+
+	if c.pendingSlots != nil {
+		if err := c.acquirePendingSlot(ctx); err != nil {
+			return nil, err
+		}
+		defer func() { <-c.pendingSlots }()
+	}
+
+	p := &pendingRequest{
+		field: idField,
+		resp:  make(chan []byte, 1),
+	}
+	if err := c.addPending(key, p); err != nil {
+		return nil, err
+	}
+	defer c.removePending(key)
+
+	if err := c.SendJSON(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case data := <-p.resp:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closing():
+		return nil, ErrClosed
+	}
+}
+
+// SendAndWaitAll sends req to the server like SendAndWait, for requests
+// answered by several responses, e.g. the pages of a query. It collects the
+// responses carrying the same value in idField until isFinal returns true
+// for one, and returns them all, the final one last. If ctx is done or the
+// client is closed first, the responses received so far are returned with
+// the error.
+//
+// The responses are not passed to OnMessage. Reading from the server waits
+// while SendAndWaitAll is busy handing over a response.
+func (c *WSClient) SendAndWaitAll(ctx context.Context, req M, idField string, isFinal func([]byte) bool) (responses [][]byte, err error) {
+	req, key := c.withRequestID(req, idField)
+
+	if c.tracer != nil {
+		var span Span
+		ctx, span = c.startRequestSpan(ctx, req)
+		defer func() { span.End(err) }()
+	}
+
+	if c.pendingSlots != nil {
+		if err := c.acquirePendingSlot(ctx); err != nil {
+			return nil, err
+		}
+		defer func() { <-c.pendingSlots }()
+	}
+
+	p := &pendingRequest{
+		field: idField,
+		resp:  make(chan []byte, 1),
+		all:   true,
+		done:  make(chan struct{}),
+	}
+	if err := c.addPending(key, p); err != nil {
+		return nil, err
+	}
+	defer func() {
+		// release deliverResponse before taking the lock it holds
+		close(p.done)
+		c.removePending(key)
+	}()
+
+	if err := c.SendJSON(req); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case data := <-p.resp:
+			responses = append(responses, data)
+			if isFinal(data) {
+				return responses, nil
+			}
+		case <-ctx.Done():
+			return responses, ctx.Err()
+		case <-c.closing():
+			return responses, ErrClosed
+		}
+	}
+}
+
+// WithIDGenerator sets the function generating the ids of the requests sent
+// with SendAndWait that have none, e.g. UUIDs matching what the server logs.
+// It must return a different id on every call and be safe for concurrent
+// use. By default the ids are "1", "2", "3"...
+func WithIDGenerator(fn func() string) Option {
+	return func(c *WSClient) {
+		c.idGenerator = fn
+	}
+}
+
+// newID returns the id of a new request
+func (c *WSClient) newID() string {
+	if c.idGenerator != nil {
+		return c.idGenerator()
+	}
+	return strconv.FormatUint(atomic.AddUint64(&c.nextID, 1), 10)
+}
+
+func (c *WSClient) acquirePendingSlot(ctx context.Context) error {
+	if c.pendingPolicy == PendingFail {
+		select {
+		case c.pendingSlots <- struct{}{}:
+			return nil
+		default:
+			return ErrTooManyPending
+		}
+	}
+	select {
+	case c.pendingSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closing():
+		return ErrClosed
+	}
+}
+
+// addPending registers p under key, the id of its request
+func (c *WSClient) addPending(key string, p *pendingRequest) error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if _, exists := c.pending[key]; exists {
+		return fmt.Errorf("wsclient: request id %q already pending", key)
+	}
+	c.pending[key] = p
+	return nil
+}
+
+func (c *WSClient) removePending(key string) {
+	c.pendingMu.Lock()
+	delete(c.pending, key)
+	c.pendingMu.Unlock()
+}
+
+// deliverResponse hands data to the SendAndWait call it answers. It returns
+// false if data is not a response to a pending request.
+func (c *WSClient) deliverResponse(data []byte) bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if len(c.pending) == 0 {
+		return false
+	}
+
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return false
+	}
+	for key, p := range c.pending {
+		id, ok := fields[p.field]
+		if !ok || idKey(id) != key {
+			continue
+		}
+		if p.all {
+			select {
+			case p.resp <- c.retain(data):
+			case <-p.done:
+				// SendAndWaitAll returned, the response is not wanted
+				// anymore
+				return false
+			}
+			return true
+		}
+		// resp is buffered and the entry is removed here, so this never
+		// blocks and each request gets at most one response
+		p.resp <- c.retain(data)
+		delete(c.pending, key)
+		return true
+	}
+	return false
+}
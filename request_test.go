@@ -0,0 +1,282 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendAndWait(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			var req M
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			conn.WriteJSON(M{"id": req["id"], "op": "pong"})
+		}
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	req := M{"op": "ping"}
+	data, err := ws.SendAndWait(ctx, req, "id")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var resp M
+	assert.NoError(t, json.Unmarshal(data, &resp))
+	assert.Equal(t, "pong", resp["op"])
+	assert.Empty(t, ws.pending)
+	// the id is set on the message sent, not on the caller's map
+	assert.Equal(t, M{"op": "ping"}, req)
+
+	// a nil request is sent as a message with only the id
+	data, err = ws.SendAndWait(ctx, nil, "id")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `"pong"`)
+	}
+}
+
+func TestSendAndWaitTimeout(t *testing.T) {
+	timedOut := make(chan bool)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		var req M
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		// reply only after the client gave up on the request
+		<-timedOut
+		conn.WriteJSON(M{"id": req["id"], "op": "late"})
+		conn.ReadMessage()
+	})
+
+	late := make(chan []byte, 1)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		late <- data
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	reqCtx, reqCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer reqCancel()
+	_, err := ws.SendAndWait(reqCtx, M{"op": "ping"}, "id")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	ws.pendingMu.Lock()
+	assert.Empty(t, ws.pending)
+	ws.pendingMu.Unlock()
+	close(timedOut)
+
+	// the orphaned reply falls through to OnMessage
+	select {
+	case data := <-late:
+		assert.Contains(t, string(data), `"late"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for late reply")
+	}
+}
+
+func TestMaxPendingRequestsUnlimited(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082", WithMaxPendingRequests(1, PendingBlock),
+		WithMaxPendingRequests(0, PendingBlock))
+	assert.Nil(t, ws.pendingSlots)
+}
+
+func TestMaxPendingRequests(t *testing.T) {
+	for _, policy := range []PendingPolicy{PendingFail, PendingBlock} {
+		release := make(chan bool)
+		u := newTestServer(t, func(conn *websocket.Conn) {
+			// never reply
+			<-release
+		})
+
+		ws := NewWSClient(u, WithMaxPendingRequests(1, policy))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if !assert.NoError(t, ws.Dial(ctx)) {
+			cancel()
+			close(release)
+			return
+		}
+
+		// occupy the only slot
+		first := make(chan error)
+		go func() {
+			_, err := ws.SendAndWait(ctx, M{"op": "first"}, "id")
+			first <- err
+		}()
+		for len(ws.pendingSlots) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		reqCtx, reqCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		_, err := ws.SendAndWait(reqCtx, M{"op": "second"}, "id")
+		reqCancel()
+		if policy == PendingFail {
+			assert.Equal(t, ErrTooManyPending, err)
+		} else {
+			assert.Equal(t, context.DeadlineExceeded, err)
+		}
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-first)
+		assert.Equal(t, 0, len(ws.pendingSlots))
+		ws.Close()
+		close(release)
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	ids := make(chan interface{}, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			var req M
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			ids <- req["id"]
+			conn.WriteJSON(M{"id": req["id"]})
+		}
+	})
+
+	var n int
+	ws := NewWSClient(u, WithIDGenerator(func() string {
+		n++
+		return fmt.Sprintf("req-%d", n)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for _, want := range []string{"req-1", "req-2"} {
+		data, err := ws.SendAndWait(ctx, M{"op": "ping"}, "id")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"id":"`+want+`"}`, string(data))
+		assert.Equal(t, want, <-ids)
+	}
+}
+
+func TestSendAndWaitAll(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			var req M
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			// a message of another request in between the chunks
+			conn.WriteJSON(M{"id": "other", "page": 0})
+			for i := 1; i <= 3; i++ {
+				conn.WriteJSON(M{"id": req["id"], "page": i})
+			}
+			conn.WriteJSON(M{"id": req["id"], "done": true})
+		}
+	})
+
+	other := make(chan []byte, 1)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		other <- data
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	isFinal := func(data []byte) bool {
+		var resp M
+		return json.Unmarshal(data, &resp) == nil && resp["done"] == true
+	}
+	responses, err := ws.SendAndWaitAll(ctx, M{"op": "query"}, "id", isFinal)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, responses, 4) {
+		for i := 0; i < 3; i++ {
+			assert.JSONEq(t, fmt.Sprintf(`{"id":"1","page":%d}`, i+1), string(responses[i]))
+		}
+		assert.JSONEq(t, `{"id":"1","done":true}`, string(responses[3]))
+	}
+	assert.JSONEq(t, `{"id":"other","page":0}`, string(<-other))
+	assert.Empty(t, ws.pending)
+}
+
+func TestSendAndWaitAllTimeout(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		var req M
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		conn.WriteJSON(M{"id": req["id"], "page": 1})
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	short, cancelShort := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelShort()
+	responses, err := ws.SendAndWaitAll(short, M{"op": "query"}, "id", func([]byte) bool { return false })
+	assert.Equal(t, context.DeadlineExceeded, err)
+	if assert.Len(t, responses, 1) {
+		assert.JSONEq(t, `{"id":"1","page":1}`, string(responses[0]))
+	}
+	assert.Empty(t, ws.pending)
+}
+
+func TestSendAndWaitNumericID(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			// echo the id as it was written
+			var req map[string]json.RawMessage
+			json.Unmarshal(data, &req)
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"id":`+string(req["id"])+`,"op":"pong"}`))
+		}
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for _, id := range []interface{}{1000000, int64(123456789), 1e6, uint64(1) << 60} {
+		data, err := ws.SendAndWait(ctx, M{"id": id, "op": "ping"}, "id")
+		if assert.NoError(t, err, "id %v", id) {
+			assert.Contains(t, string(data), `"pong"`)
+		}
+		responses, err := ws.SendAndWaitAll(ctx, M{"id": id, "op": "ping"}, "id", func([]byte) bool { return true })
+		assert.NoError(t, err, "id %v", id)
+		assert.Len(t, responses, 1)
+	}
+}
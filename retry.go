@@ -0,0 +1,127 @@
+package wsclient
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeRetry holds the message whose write failed, waiting for the next
+// connection, see WithWriteRetry
+type writeRetry struct {
+	attempts int
+	backoff  time.Duration
+
+	mu sync.Mutex
+	m  *message
+	at time.Time // when m may be written again
+}
+
+// WithWriteRetry retries a message whose write failed with a network error,
+// such as a timeout or a reset connection, up to attempts times, instead of
+// losing it. A failed write always ends the connection: gorilla/websocket
+// returns the first error from every later write, and a frame partially
+// written cannot be completed. The message is written again first on the
+// next connection, no sooner than backoff after the failure, so retrying
+// takes a new connection, see WithReconnect. Other errors, e.g. for a close
+// frame already sent, are not retried. The ack channel of SendJSONAck
+// receives the result of the last attempt, ErrClosed if the client is
+// closed in the meantime. Messages sent with WithReliableDelivery are
+// replayed rather than retried.
+func WithWriteRetry(attempts int, backoff time.Duration) Option {
+	return func(c *WSClient) {
+		if attempts <= 0 {
+			c.writeRetry = nil
+			return
+		}
+		c.writeRetry = &writeRetry{attempts: attempts, backoff: backoff}
+	}
+}
+
+// retryableWrite tells whether a write that failed with err can succeed on a
+// new connection: a network error rather than a connection closed on purpose
+func retryableWrite(err error) bool {
+	if errors.Is(err, websocket.ErrCloseSent) || errors.Is(err, net.ErrClosed) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryLater keeps m, whose write to conn failed with err, for the next
+// connection. It returns false if m is not to be retried.
+func (c *WSClient) retryLater(conn *connection, m *message, err error) bool {
+	r := c.writeRetry
+	if r == nil || m.seq != 0 || m.retries >= r.attempts || !retryableWrite(err) {
+		return false
+	}
+	if !m.deadline.IsZero() && !time.Now().Before(m.deadline) {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// checked under mu, so that the message is not kept after dropRetry
+	if isDone(conn.closing) {
+		return false
+	}
+	m.retries++
+	r.m, r.at = m, time.Now().Add(r.backoff)
+	c.logf("write: retrying in %s: %s", r.backoff, err.Error())
+	return true
+}
+
+// writeRetried writes the message kept by retryLater to conn
+func (c *WSClient) writeRetried(conn *connection) error {
+	r := c.writeRetry
+	r.mu.Lock()
+	m, at := r.m, r.at
+	r.m = nil
+	r.mu.Unlock()
+	if m == nil {
+		return nil
+	}
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-conn.done:
+		r.mu.Lock()
+		if isDone(conn.closing) {
+			r.mu.Unlock()
+			c.drop(m.data, DropClosed)
+			m.release()
+			if m.ack != nil {
+				m.ack <- ErrClosed
+			}
+			return nil
+		}
+		r.m = m
+		r.mu.Unlock()
+		return nil
+	}
+	return c.writeMessage(conn, m)
+}
+
+// dropRetry discards the message kept by retryLater after the client was
+// closed
+func (c *WSClient) dropRetry() {
+	r := c.writeRetry
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	m := r.m
+	r.m = nil
+	r.mu.Unlock()
+	if m == nil {
+		return
+	}
+	c.drop(m.data, DropClosed)
+	m.release()
+	if m.ack != nil {
+		m.ack <- ErrClosed
+	}
+}
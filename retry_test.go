@@ -0,0 +1,121 @@
+package wsclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyConn fails one write with a reset connection when failNext is set
+type flakyConn struct {
+	net.Conn
+	failNext *int32
+}
+
+func (c *flakyConn) Write(b []byte) (int, error) {
+	if atomic.CompareAndSwapInt32(c.failNext, 1, 0) {
+		return 0, &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	return c.Conn.Write(b)
+}
+
+func TestWriteRetry(t *testing.T) {
+	var conns int32
+	received := make(chan string, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&conns, 1)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	var failNext int32
+	ws := NewWSClient(u, WithLogger(discardLogger{}),
+		WithReconnect(ReconnectConfig{InitialDelay: 10 * time.Millisecond}),
+		WithWriteRetry(2, 10*time.Millisecond),
+		WithNetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &flakyConn{Conn: conn, failNext: &failNext}, nil
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	atomic.StoreInt32(&failNext, 1)
+	ack, err := ws.SendJSONAck(M{"op": "hello"})
+	assert.NoError(t, err)
+	select {
+	case data := <-received:
+		assert.JSONEq(t, `{"op":"hello"}`, data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the retried message")
+	}
+	assert.NoError(t, <-ack)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&conns))
+}
+
+func TestWriteRetryClosed(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	// without reconnection, the message kept for retrying is dropped when
+	// the lost connection closes the client
+	var failNext int32
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithWriteRetry(1, 0),
+		WithNetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &flakyConn{Conn: conn, failNext: &failNext}, nil
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	atomic.StoreInt32(&failNext, 1)
+	ack, err := ws.SendJSONAck(M{"op": "hello"})
+	assert.NoError(t, err)
+	select {
+	case err := <-ack:
+		assert.Equal(t, ErrClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the ack")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestRetryableWrite(t *testing.T) {
+	assert.True(t, retryableWrite(&net.OpError{Op: "write", Err: syscall.ECONNRESET}))
+	assert.True(t, retryableWrite(timeoutError{}))
+	assert.False(t, retryableWrite(websocket.ErrCloseSent))
+	assert.False(t, retryableWrite(&net.OpError{Op: "write", Err: net.ErrClosed}))
+	assert.False(t, retryableWrite(errors.New("invalid frame")))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,52 @@
+package wsclient
+
+import "encoding/json"
+
+// SetHandlers routes the messages from the server by their type, the value
+// of the type field, see WithTypeField: a message whose type is a key of
+// handlers is passed to that function instead of OnMessage, OnTextMessage or
+// OnBinaryMessage, the others are passed to those as usual. It replaces the
+// handlers set by a previous call at once, e.g. when the application
+// switches from one mode to another: every message is routed by either the
+// previous or the new handlers, never a mix. A nil or empty map removes
+// them. handlers is copied; changing it afterwards has no effect. With
+// WithPooledReadBuffers, the data passed to the handlers is only valid
+// until they return, like for OnMessage: it must be copied to be kept.
+func (c *WSClient) SetHandlers(handlers map[string]func(data []byte)) {
+	var routes map[string]func([]byte)
+	if len(handlers) > 0 {
+		routes = make(map[string]func([]byte), len(handlers))
+		for t, fn := range handlers {
+			routes[t] = fn
+		}
+	}
+	c.routesMu.Lock()
+	c.routes = routes
+	c.routesMu.Unlock()
+}
+
+// route passes data to the handler for its type, see SetHandlers. It returns
+// false if there is none.
+func (c *WSClient) route(data []byte) bool {
+	c.routesMu.RLock()
+	routes := c.routes
+	c.routesMu.RUnlock()
+	if routes == nil {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	var t string
+	if err := json.Unmarshal(fields[c.typeField], &t); err != nil {
+		return false
+	}
+	fn, ok := routes[t]
+	if !ok {
+		return false
+	}
+	fn(data)
+	return true
+}
@@ -0,0 +1,85 @@
+package wsclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetHandlers(t *testing.T) {
+	const count = 500
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < count; i++ {
+			kind := "move"
+			if i%2 == 1 {
+				kind = "chat"
+			}
+			conn.WriteJSON(M{"type": kind, "n": i})
+		}
+		conn.WriteJSON(M{"type": "other"})
+		conn.ReadMessage()
+	})
+
+	var mu sync.Mutex
+	var sets []string
+	handlers := func(set string) map[string]func([]byte) {
+		record := func([]byte) {
+			mu.Lock()
+			sets = append(sets, set)
+			mu.Unlock()
+		}
+		return map[string]func([]byte){"move": record, "chat": record}
+	}
+
+	other := make(chan string, 1)
+	ws := NewWSClient(u)
+	ws.SetHandlers(handlers("lobby"))
+	ws.OnMessage(func(data []byte) {
+		other <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// swap while the messages flow
+	time.Sleep(time.Millisecond)
+	ws.SetHandlers(handlers("game"))
+
+	select {
+	case data := <-other:
+		assert.JSONEq(t, `{"type":"other"}`, data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// every message was handled once, by the lobby handlers until the swap
+	// and by the game handlers from then on
+	if assert.Len(t, sets, count) {
+		swapped := false
+		for i, set := range sets {
+			if set == "game" {
+				swapped = true
+			} else if swapped {
+				t.Fatalf("message %d handled by the lobby handlers after the swap", i)
+			}
+		}
+	}
+}
+
+func TestSetHandlersRemove(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	ws.SetHandlers(map[string]func([]byte){"move": func([]byte) {}})
+	assert.True(t, ws.route([]byte(`{"type":"move"}`)))
+	assert.False(t, ws.route([]byte(`{"type":"chat"}`)))
+	assert.False(t, ws.route([]byte(`not json`)))
+	ws.SetHandlers(nil)
+	assert.False(t, ws.route([]byte(`{"type":"move"}`)))
+}
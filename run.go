@@ -0,0 +1,40 @@
+package wsclient
+
+import "context"
+
+// Run connects to the server and blocks until ctx is done or the client is
+// closed, e.g. by Close or because reconnection gave up, see WithReconnect,
+// so that the main function of a small tool can be the registration of its
+// callbacks followed by Run. Messages are processed by the callbacks in the
+// meantime.
+//
+// Run returns the error of the first dial, as Open does, and otherwise waits
+// for Close to complete before returning. It returns nil when ctx is done,
+// the last dial error when reconnection gave up and CloseError otherwise.
+func (c *WSClient) Run(ctx context.Context) error {
+	if err := c.Open(ctx); err != nil {
+		return err
+	}
+	canceled := false
+	select {
+	case <-c.closing():
+	case <-ctx.Done():
+		canceled = true
+		c.Close()
+	}
+	c.closedMu.RLock()
+	closeDone := c.closeDone
+	c.closedMu.RUnlock()
+	if closeDone != nil {
+		<-closeDone
+	}
+	if canceled {
+		return nil
+	}
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	if c.giveUpErr != nil {
+		return c.giveUpErr
+	}
+	return c.closeErr
+}
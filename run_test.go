@@ -0,0 +1,77 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{}))
+	ws.OnMessage(func(data []byte) {
+		assert.Equal(t, "hello", string(data))
+		cancel()
+	})
+	closed := make(chan bool, 1)
+	ws.OnClose(func() {
+		closed <- true
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ws.Run(ctx)
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Run")
+	}
+	// Close has completed by the time Run returns
+	select {
+	case <-closed:
+	default:
+		t.Fatal("Run returned before the client was closed")
+	}
+	assert.Equal(t, StateClosed, ws.State())
+	waitShutdown(t, ws)
+}
+
+func TestRunGiveUp(t *testing.T) {
+	u, _ := newFlakyServer(t)
+
+	var gaveUp error
+	ws := NewWSClient(u, WithReconnect(ReconnectConfig{
+		InitialDelay: 10 * time.Millisecond,
+		MaxAttempts:  1,
+	}))
+	ws.OnGiveUp(func(err error) {
+		gaveUp = err
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := ws.Run(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, gaveUp, err)
+	assert.NoError(t, ctx.Err())
+	waitShutdown(t, ws)
+}
+
+func TestRunDialError(t *testing.T) {
+	ws := NewWSClient("ws://127.0.0.1:1")
+	assert.Error(t, ws.Run(context.Background()))
+}
@@ -0,0 +1,64 @@
+package wsclient
+
+// Batch stages JSON messages to send them together, see WSClient.Batch
+type Batch struct {
+	c     *WSClient
+	items []M
+}
+
+// Batch returns a builder for a group of JSON messages sent together with
+// Commit, in the order they were added and without messages from other
+// goroutines in between, except for the messages of SendJSONPriority, which
+// are written ahead of the messages waiting to be written, a batch's too.
+// Unlike SendJSONBatch, every item is sent as a frame of its own. A Batch is
+// not safe for concurrent use.
+func (c *WSClient) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+// Add stages j to be sent on Commit
+func (b *Batch) Add(j M) {
+	b.items = append(b.items, j)
+}
+
+// Commit marshals the staged messages and sends them, only if all of them
+// could be marshaled; otherwise nothing is sent and the marshal error is
+// returned. A send error, e.g. ErrReconnecting after the connection was
+// lost, stops the batch: the messages before the failed one were sent, the
+// ones after it are dropped. The batch is empty afterwards.
+func (b *Batch) Commit() error {
+	c := b.c
+	items := b.items
+	b.items = nil
+
+	msgs := make([]*message, 0, len(items))
+	for _, j := range items {
+		m, err := c.newJSONMessage(c.messageType, j)
+		if err != nil {
+			c.logf("Batch: Marshal error: %s", err.Error())
+			c.dropMessages(msgs)
+			return err
+		}
+		msgs = append(msgs, m)
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	for i, m := range msgs {
+		if err := c.enqueueLocked(m, true); err != nil {
+			c.dropMessages(msgs[i+1:])
+			return err
+		}
+	}
+	return nil
+}
+
+// dropMessages discards messages that were built but never enqueued
+func (c *WSClient) dropMessages(msgs []*message) {
+	for _, m := range msgs {
+		if m.seq != 0 {
+			c.reliable.forget(m.seq)
+		}
+		m.release()
+	}
+}
@@ -0,0 +1,53 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchCommit(t *testing.T) {
+	received := make(chan string, 4)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	b := ws.Batch()
+	b.Add(M{"n": 1})
+	b.Add(M{"bad": make(chan int)})
+	b.Add(M{"n": 3})
+	assert.Error(t, b.Commit())
+
+	b.Add(M{"n": 4})
+	b.Add(M{"n": 5})
+	assert.NoError(t, b.Commit())
+	assert.NoError(t, b.Commit(), "an empty batch sends nothing")
+	assert.NoError(t, ws.SendJSON(M{"n": 6}))
+
+	// nothing from the failed batch was sent
+	for _, want := range []string{`{"n":4}`, `{"n":5}`, `{"n":6}`} {
+		select {
+		case data := <-received:
+			assert.Equal(t, want, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package wsclient
+
+import "context"
+
+// State is the lifecycle state of a WSClient
+type State int
+
+const (
+	// StateIdle is the state of a client that has not connected yet
+	StateIdle State = iota
+	// StateConnecting is the state while the initial dial is in progress
+	StateConnecting
+	// StateConnected is the state while a connection is open
+	StateConnected
+	// StateDisconnected is the state right after a connection was lost or
+	// a dial failed
+	StateDisconnected
+	// StateBackingOff is the state while waiting before a reconnect attempt
+	StateBackingOff
+	// StateReconnecting is the state while a reconnect dial is in progress
+	StateReconnecting
+	// StateClosed is the final state after Close
+	StateClosed
+)
+
+// Number of transitions buffered for each WatchState channel
+const stateWatchBuffer = 64
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateBackingOff:
+		return "backing off"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// State returns the current lifecycle state of the client
+func (c *WSClient) State() State {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+// IsReconnecting reports whether the client lost its connection and is
+// trying to re-establish it, i.e. the state is StateBackingOff or
+// StateReconnecting
+func (c *WSClient) IsReconnecting() bool {
+	s := c.State()
+	return s == StateBackingOff || s == StateReconnecting
+}
+
+// WatchState returns a channel that receives every state transition from now
+// on. The channel is closed after the client reaches StateClosed. Transitions
+// are buffered; a watcher that falls more than 64 transitions behind misses
+// the newer ones.
+func (c *WSClient) WatchState() <-chan State {
+	ch := make(chan State, stateWatchBuffer)
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.state == StateClosed {
+		close(ch)
+		return ch
+	}
+	c.watchers = append(c.watchers, ch)
+	return ch
+}
+
+// WaitState blocks until the client reaches the target state and returns
+// nil, right away if it is in that state already. It returns ctx.Err() if
+// ctx is done first, and ErrClosed if the client is closed before reaching
+// target.
+func (c *WSClient) WaitState(ctx context.Context, target State) error {
+	c.stateMu.Lock()
+	current := c.state
+	if current == target {
+		c.stateMu.Unlock()
+		return nil
+	}
+	if current == StateClosed {
+		c.stateMu.Unlock()
+		return ErrClosed
+	}
+	ch := make(chan State, stateWatchBuffer)
+	c.watchers = append(c.watchers, ch)
+	c.stateMu.Unlock()
+	defer c.unwatchState(ch)
+
+	for {
+		select {
+		case s, ok := <-ch:
+			if !ok {
+				if target == StateClosed {
+					return nil
+				}
+				return ErrClosed
+			}
+			if s == target {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// unwatchState stops sending the transitions to ch
+func (c *WSClient) unwatchState(ch chan State) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	for i, w := range c.watchers {
+		if w == ch {
+			c.watchers = append(c.watchers[:i], c.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *WSClient) setState(s State) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.transition(s)
+}
+
+// beginConnect moves the client to StateConnecting for Open, unless it is
+// connected or trying to connect already
+func (c *WSClient) beginConnect() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	switch c.state {
+	case StateIdle, StateDisconnected, StateClosed:
+		c.transition(StateConnecting)
+		return true
+	}
+	return false
+}
+
+// transition sets the state to s and notifies the watchers. stateMu must be
+// held.
+func (c *WSClient) transition(s State) {
+	if c.state == s {
+		return
+	}
+	c.state = s
+	for _, ch := range c.watchers {
+		select {
+		case ch <- s:
+		default:
+		}
+	}
+}
+
+func (c *WSClient) closeWatchers() {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	for _, ch := range c.watchers {
+		close(ch)
+	}
+	c.watchers = nil
+}
@@ -0,0 +1,58 @@
+package wsclient
+
+// Stats are the traffic counters of a client, see WSClient.Stats
+type Stats struct {
+	// Name is the name of the client, see WithName
+	Name string
+	// ConnID identifies the current or last connection. It starts at 1 for
+	// the first connection and is incremented on every (re)connection; 0
+	// means the client never connected.
+	ConnID uint64
+
+	// The counters cover every connection since the client was created or
+	// ResetStats was last called. Only data frames are counted, by their
+	// payload size.
+	BytesSent        int64
+	BytesReceived    int64
+	MessagesSent     int64
+	MessagesReceived int64
+	// DroppedMessages counts the messages accepted for sending that were
+	// not written, see OnDrop
+	DroppedMessages int64
+}
+
+// Stats returns the traffic counters of the client
+func (c *WSClient) Stats() Stats {
+	c.connMu.RLock()
+	id := c.connID
+	c.connMu.RUnlock()
+
+	// the write lock waits for the counters being updated, so that they are
+	// consistent with each other
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return Stats{
+		Name:             c.name,
+		ConnID:           id,
+		BytesSent:        c.stats.bytesSent,
+		BytesReceived:    c.stats.bytesReceived,
+		MessagesSent:     c.stats.messagesSent,
+		MessagesReceived: c.stats.messagesReceived,
+		DroppedMessages:  c.stats.droppedMessages,
+	}
+}
+
+// ResetStats zeroes the traffic counters returned by Stats, e.g. at the end
+// of every reporting interval. ConnID is left alone.
+func (c *WSClient) ResetStats() {
+	c.statsMu.Lock()
+	c.stats = connStats{}
+	c.statsMu.Unlock()
+}
+
+// countTraffic adds a frame of n bytes to the counters of the client
+func (c *WSClient) countTraffic(dir Direction, n int) {
+	c.statsMu.RLock()
+	c.stats.add(dir, n)
+	c.statsMu.RUnlock()
+}
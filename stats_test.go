@@ -0,0 +1,154 @@
+package wsclient
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetStats(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, data)
+		}
+	})
+
+	echoed := make(chan bool)
+	ws := NewWSClient(u, WithName("stats"))
+	ws.OnMessage(func(data []byte) {
+		echoed <- true
+	})
+	assert.Equal(t, Stats{Name: "stats"}, ws.Stats())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	exchange := func(texts ...string) {
+		for _, text := range texts {
+			assert.NoError(t, ws.SendText(text))
+			select {
+			case <-echoed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for echo")
+			}
+		}
+	}
+
+	exchange("ab", "cd")
+	assert.Equal(t, Stats{
+		Name:             "stats",
+		ConnID:           1,
+		BytesSent:        4,
+		BytesReceived:    4,
+		MessagesSent:     2,
+		MessagesReceived: 2,
+	}, ws.Stats())
+
+	ws.ResetStats()
+	assert.Equal(t, Stats{Name: "stats", ConnID: 1}, ws.Stats())
+
+	exchange("xyz")
+	assert.Equal(t, Stats{
+		Name:             "stats",
+		ConnID:           1,
+		BytesSent:        3,
+		BytesReceived:    3,
+		MessagesSent:     1,
+		MessagesReceived: 1,
+	}, ws.Stats())
+}
+
+func TestOnBytes(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, append(data, '!'))
+		}
+	})
+
+	var read, written int64
+	echoed := make(chan bool)
+	ws := NewWSClient(u)
+	ws.OnBytesRead(func(n int) {
+		atomic.AddInt64(&read, int64(n))
+	})
+	ws.OnBytesWritten(func(n int) {
+		atomic.AddInt64(&written, int64(n))
+	})
+	ws.OnMessage(func(data []byte) {
+		echoed <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for _, payload := range [][]byte{[]byte("hello"), make([]byte, 4096)} {
+		assert.NoError(t, ws.SendBinary(payload))
+		select {
+		case <-echoed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for echo")
+		}
+	}
+	assert.EqualValues(t, 5+4096, atomic.LoadInt64(&written))
+	assert.EqualValues(t, 6+4097, atomic.LoadInt64(&read))
+}
+
+func TestOnSent(t *testing.T) {
+	received := make(chan string, 3)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+
+	sent := make(chan string, 3)
+	ws := NewWSClient(u, WithPooledBuffers())
+	ws.OnSent(func(data []byte) {
+		sent <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ws.SendJSON(M{"n": i}))
+	}
+	for i := 0; i < 3; i++ {
+		want := fmt.Sprintf(`{"n":%d}`, i)
+		for _, ch := range []chan string{sent, received} {
+			select {
+			case data := <-ch:
+				assert.Equal(t, want, data)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the messages")
+			}
+		}
+	}
+	assert.Empty(t, sent, "OnSent called more than once per message")
+}
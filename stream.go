@@ -0,0 +1,45 @@
+package wsclient
+
+import "io"
+
+// OnReader is the callback function when a message is received from the
+// server, for streaming large messages instead of buffering them whole.
+// Once it is set, every message is passed to it as a reader of its payload,
+// which receives the frames of the message as they arrive, and none is
+// passed to the other callbacks. It is called from the read goroutine: the
+// next message is read once it returns, and the part of r it did not read
+// is discarded. r must not be used after it returns.
+//
+// The features that need the whole message do not apply to the messages
+// streamed: SendAndWait, ReceiveJSON, WaitFor, SubscribeContext, batches,
+// the history, the frame tap and payload logging. The traffic is still
+// counted in Stats and passed to OnBytesRead.
+func (c *WSClient) OnReader(fn func(messageType int, r io.Reader)) {
+	c.callbacksMu.Lock()
+	c.cb.onReader = fn
+	c.callbacksMu.Unlock()
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	return n, err
+}
+
+// readStream reads the next message from conn and passes it to OnReader
+func (c *WSClient) readStream(conn *connection) error {
+	mt, r, err := conn.ws.NextReader()
+	if err != nil {
+		return err
+	}
+	cr := &countingReader{r: r}
+	c.callbacks().onReader(mt, cr)
+	c.count(conn, Inbound, cr.n)
+	return nil
+}
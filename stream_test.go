@@ -0,0 +1,72 @@
+package wsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnReader(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1<<18)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		// stream the payload in several frames
+		w, err := conn.NextWriter(websocket.BinaryMessage)
+		if err != nil {
+			return
+		}
+		for data := payload; len(data) > 0; data = data[64<<10:] {
+			w.Write(data[:64<<10])
+		}
+		w.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte("done"))
+		conn.ReadMessage()
+	})
+
+	type message struct {
+		mt   int
+		size int
+		sum  [sha256.Size]byte
+	}
+	received := make(chan message, 2)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		t.Error("OnMessage called while OnReader is set")
+	})
+	ws.OnReader(func(mt int, r io.Reader) {
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		assert.NoError(t, err)
+		m := message{mt: mt, size: int(n)}
+		copy(m.sum[:], h.Sum(nil))
+		received <- m
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	for _, want := range []message{
+		{websocket.BinaryMessage, len(payload), sha256.Sum256(payload)},
+		{websocket.TextMessage, 4, sha256.Sum256([]byte("done"))},
+	} {
+		select {
+		case m := <-received:
+			assert.Equal(t, want, m)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the message")
+		}
+	}
+	// the traffic is counted once OnReader returns
+	assert.Eventually(t, func() bool {
+		stats := ws.Stats()
+		return stats.MessagesReceived == 2 && stats.BytesReceived == int64(len(payload)+4)
+	}, 5*time.Second, time.Millisecond)
+}
@@ -0,0 +1,56 @@
+package wsclient
+
+import "errors"
+
+// ErrSubprotocolMismatch is returned by Open, and passed to OnError for a
+// reconnection attempt, when the server did not select one of the
+// subprotocols offered, see WithRequireSubprotocol
+var ErrSubprotocolMismatch = errors.New("wsclient: subprotocol mismatch")
+
+// WithSubprotocols offers protocols, in order of preference, to the server
+// in the handshake. The one the server selected is returned by Subprotocol.
+func WithSubprotocols(protocols ...string) Option {
+	return func(c *WSClient) {
+		c.dialer.Subprotocols = protocols
+	}
+}
+
+// WithRequireSubprotocol makes a handshake fail with ErrSubprotocolMismatch
+// when subprotocols are offered, see WithSubprotocols, and the server selects
+// none of them, so the client never speaks a protocol the server did not
+// agree to. The connection is closed right away; with WithReconnect, the
+// attempt counts as a failed one.
+func WithRequireSubprotocol() Option {
+	return func(c *WSClient) {
+		c.requireSubprotocol = true
+	}
+}
+
+// Subprotocol returns the subprotocol selected by the server for the open
+// connection, or "" if there is none
+func (c *WSClient) Subprotocol() string {
+	conn := c.currentConn()
+	if conn == nil {
+		return ""
+	}
+	return conn.ws.Subprotocol()
+}
+
+// checkSubprotocol checks that selected is one of the offered subprotocols
+func (c *WSClient) checkSubprotocol(selected string) error {
+	offered := c.dialer.Subprotocols
+	if len(offered) == 0 {
+		return nil
+	}
+	for _, p := range offered {
+		if p == selected {
+			return nil
+		}
+	}
+	if selected == "" {
+		c.logf("subprotocol: server selected none of %q", offered)
+	} else {
+		c.logf("subprotocol: server selected %q, not one of %q", selected, offered)
+	}
+	return ErrSubprotocolMismatch
+}
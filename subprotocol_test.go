@@ -0,0 +1,71 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSubprotocolServer starts a server that selects the first of the
+// subprotocols it supports that the client offered
+func newSubprotocolServer(t *testing.T, supported ...string) string {
+	upgrader := websocket.Upgrader{Subprotocols: supported}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func TestRequireSubprotocol(t *testing.T) {
+	open := func(u string, opts ...Option) (string, error) {
+		ws := NewWSClient(u, append(opts, WithLogger(discardLogger{}), WithSubprotocols("chat.v2", "chat.v1"))...)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := ws.Open(ctx); err != nil {
+			return "", err
+		}
+		defer waitShutdown(t, ws)
+		defer ws.Close()
+		return ws.Subprotocol(), nil
+	}
+
+	none := newSubprotocolServer(t)
+	v1 := newSubprotocolServer(t, "chat.v1")
+
+	p, err := open(v1, WithRequireSubprotocol())
+	assert.NoError(t, err)
+	assert.Equal(t, "chat.v1", p)
+	// without the requirement, a server ignoring the offer is accepted
+	p, err = open(none)
+	assert.NoError(t, err)
+	assert.Equal(t, "", p)
+	_, err = open(none, WithRequireSubprotocol())
+	assert.Equal(t, ErrSubprotocolMismatch, err)
+
+	// Connect reports it to OnError
+	errs := make(chan error, 1)
+	ws := NewWSClient(none, WithLogger(discardLogger{}), WithSubprotocols("chat.v2"), WithRequireSubprotocol())
+	ws.OnError(func(err error) {
+		errs <- err
+	})
+	ws.Connect()
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrSubprotocolMismatch, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnError")
+	}
+	waitShutdown(t, ws)
+}
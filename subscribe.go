@@ -0,0 +1,154 @@
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+)
+
+// subscriptionBuffer is the number of messages a subscription holds before
+// reading from the server waits for its receiver
+const subscriptionBuffer = 16
+
+// subscription is a SubscribeContext or Stream call receiving the messages
+// whose field holds value
+type subscription struct {
+	field string
+	value string
+	ctx   context.Context
+	ch    chan []byte
+}
+
+// WithTopicField sets the name of the field that holds the topic of JSON
+// messages, see SubscribeContext. The default is "topic".
+func WithTopicField(field string) Option {
+	return func(c *WSClient) {
+		c.topicField = field
+	}
+}
+
+// SubscribeContext returns a channel receiving the messages from the server
+// whose topic field, see WithTopicField, is topic. They are passed to the
+// channel instead of OnMessage; with several subscriptions to a topic, each
+// message goes to all of them. Nothing is sent to the server: subscribing
+// there, if the protocol requires it, is up to the caller.
+//
+// The subscription ends, its channel being closed, when ctx is done or the
+// client is closed. The channel holds up to 16 messages, after which reading
+// from the server waits for the receiver.
+func (c *WSClient) SubscribeContext(ctx context.Context, topic string) <-chan []byte {
+	return c.subscribe(ctx, c.topicField, topic)
+}
+
+// subscribe returns a channel receiving the messages whose field holds
+// value until ctx is done or the client is closed
+func (c *WSClient) subscribe(ctx context.Context, field, value string) <-chan []byte {
+	s := &subscription{field: field, value: value, ctx: ctx, ch: make(chan []byte, subscriptionBuffer)}
+	c.subscriptionsMu.Lock()
+	c.subscriptions = append(c.subscriptions, s)
+	c.subscriptionsMu.Unlock()
+
+	done := c.closing()
+	c.goroutine(func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		c.unsubscribe(s)
+	})
+	return s.ch
+}
+
+// unsubscribe removes s and closes its channel
+func (c *WSClient) unsubscribe(s *subscription) {
+	c.subscriptionsMu.Lock()
+	defer c.subscriptionsMu.Unlock()
+	for i, other := range c.subscriptions {
+		if other == s {
+			c.subscriptions = append(c.subscriptions[:i], c.subscriptions[i+1:]...)
+			break
+		}
+	}
+	close(s.ch)
+}
+
+// deliverTopic passes data, read from conn, to the subscriptions to its
+// topic or stream. It returns false if there is none.
+func (c *WSClient) deliverTopic(conn *connection, data []byte) bool {
+	c.subscriptionsMu.Lock()
+	defer c.subscriptionsMu.Unlock()
+	if len(c.subscriptions) == 0 {
+		return false
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	delivered := false
+	for _, s := range c.subscriptions {
+		if value, ok := fields[s.field].(string); !ok || value != s.value {
+			continue
+		}
+		// unsubscribe waits for the lock, so the channel is still open
+		select {
+		case s.ch <- c.retain(data):
+		case <-s.ctx.Done():
+		case <-conn.closing:
+		}
+		delivered = true
+	}
+	return delivered
+}
+
+// textSink takes the text messages read from a connection, see subscribeText
+type textSink struct {
+	// deliver is called with each text message read from conn, in the read
+	// goroutine. It must return once conn is done or the client closed.
+	deliver func(conn *connection, data []byte)
+	// end is called once reading from the connection stopped
+	end func()
+}
+
+// subscribeText passes the text messages read from conn to sink, instead of
+// OnMessage and OnTextMessage, until conn ends, and ends sink then, right
+// away if conn already ended
+func (conn *connection) subscribeText(sink textSink) {
+	conn.sinksMu.Lock()
+	defer conn.sinksMu.Unlock()
+	if conn.sinksClosed {
+		sink.end()
+		return
+	}
+	conn.sinks = append(conn.sinks, sink)
+}
+
+// deliverText passes data, a message of type mt read from conn, to the sinks
+// of subscribeText. It returns false if there is none or data is not a text
+// message.
+func (c *WSClient) deliverText(conn *connection, mt int, data []byte) bool {
+	if mt != websocket.TextMessage {
+		return false
+	}
+	conn.sinksMu.Lock()
+	defer conn.sinksMu.Unlock()
+	if len(conn.sinks) == 0 {
+		return false
+	}
+	for _, sink := range conn.sinks {
+		sink.deliver(conn, data)
+	}
+	return true
+}
+
+// closeSinks ends the sinks of subscribeText once reading from conn stopped
+func (conn *connection) closeSinks() {
+	conn.sinksMu.Lock()
+	defer conn.sinksMu.Unlock()
+	conn.sinksClosed = true
+	for _, sink := range conn.sinks {
+		sink.end()
+	}
+	conn.sinks = nil
+}
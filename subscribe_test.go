@@ -0,0 +1,79 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeContext(t *testing.T) {
+	publish := make(chan M)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for m := range publish {
+			conn.WriteJSON(m)
+		}
+		conn.ReadMessage()
+	})
+
+	other := make(chan string, 1)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		other <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	defer close(publish)
+
+	subCtx, unsubscribe := context.WithCancel(ctx)
+	prices := ws.SubscribeContext(subCtx, "prices")
+	publish <- M{"topic": "prices", "price": 1}
+	select {
+	case data := <-prices:
+		assert.JSONEq(t, `{"topic":"prices","price":1}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+	publish <- M{"topic": "news"}
+	assert.JSONEq(t, `{"topic":"news"}`, <-other)
+
+	unsubscribe()
+	select {
+	case _, ok := <-prices:
+		assert.False(t, ok, "received a message after unsubscribing")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to close")
+	}
+	// the topic is no longer routed to the subscription
+	publish <- M{"topic": "prices", "price": 2}
+	assert.JSONEq(t, `{"topic":"prices","price":2}`, <-other)
+}
+
+func TestSubscribeContextClose(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	ch := ws.SubscribeContext(context.Background(), "prices")
+	ws.Close()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to close")
+	}
+	waitShutdown(t, ws)
+}
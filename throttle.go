@@ -0,0 +1,76 @@
+package wsclient
+
+import (
+	"sync"
+	"time"
+)
+
+// WithMaxInboundRate limits how fast messages are read from the server to
+// rate messages per second, with bursts of up to burst messages. Once the
+// limit is reached the client stops reading until it is within the limit
+// again, so that a server sending faster is eventually slowed down by TCP
+// flow control instead of filling up memory.
+func WithMaxInboundRate(rate float64, burst int) Option {
+	return func(c *WSClient) {
+		if rate <= 0 {
+			c.inboundLimit = nil
+			return
+		}
+		c.inboundLimit = newTokenBucket(rate, burst)
+	}
+}
+
+// tokenBucket is a rate limiter that allows rate events per second, with
+// bursts of up to burst events
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait blocks until a token is available. It returns false if conn ended or
+// the client was closed in the meantime.
+func (b *tokenBucket) wait(conn *connection) bool {
+	d := b.reserve()
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-conn.done:
+		return false
+	case <-conn.closing:
+		return false
+	}
+}
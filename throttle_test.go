@@ -0,0 +1,55 @@
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxInboundRate(t *testing.T) {
+	const count = 20
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < count; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte("tick"))
+		}
+		conn.ReadMessage()
+	})
+
+	received := make(chan time.Time, count)
+	ws := NewWSClient(u, WithMaxInboundRate(50, 5))
+	ws.OnMessage(func(data []byte) {
+		received <- time.Now()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// a burst of 5 right away, then the other 15 at 50 per second
+	var times []time.Time
+	for i := 0; i < count; i++ {
+		select {
+		case at := <-received:
+			times = append(times, at)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+	burst := times[4].Sub(times[0])
+	total := times[count-1].Sub(times[0])
+	assert.Less(t, int64(burst), int64(50*time.Millisecond), "burst took %s", burst)
+	assert.GreaterOrEqual(t, int64(total), int64(250*time.Millisecond), "messages took %s", total)
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	assert.Zero(t, b.reserve())
+	assert.Zero(t, b.reserve())
+	assert.InDelta(t, float64(100*time.Millisecond), float64(b.reserve()), float64(5*time.Millisecond))
+	assert.InDelta(t, float64(200*time.Millisecond), float64(b.reserve()), float64(5*time.Millisecond))
+}
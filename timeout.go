@@ -0,0 +1,105 @@
+package wsclient
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrInterMessageTimeout is passed to OnError when the server stopped
+	// sending in the middle of a stream, see WithInterMessageTimeout
+	ErrInterMessageTimeout = errors.New("wsclient: inter-message timeout")
+	// ErrReadTimeout is passed to OnError when nothing was received from
+	// the server for the read timeout, see WithReadTimeout
+	ErrReadTimeout = errors.New("wsclient: read timeout")
+)
+
+// WithInterMessageTimeout makes the client fail the connection when more
+// than d passes between two messages from the server, e.g. to detect a
+// stalled stream. The timer starts with the first message and restarts with
+// each one; control frames such as pongs do not restart it. The failure is
+// passed to OnError as ErrInterMessageTimeout and handled like any lost
+// connection, see WithReconnect.
+func WithInterMessageTimeout(d time.Duration) Option {
+	return func(c *WSClient) {
+		c.messageTimeout = d
+	}
+}
+
+// WithReadTimeout makes the client fail the connection when nothing is
+// received from the server for d, e.g. to match a server that drops idle
+// clients. The deadline slides: it starts with the connection and moves
+// forward with every frame received, messages and pongs alike, so that an
+// active connection never times out; with WithPingInterval shorter than d,
+// an idle connection to a responsive server does not either. The failure is
+// passed to OnError as ErrReadTimeout and handled like any lost connection,
+// see WithReconnect.
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *WSClient) {
+		c.readTimeout = d
+	}
+}
+
+// armRead sets the read deadline of conn before reading the next message.
+// received tells whether a message was received since the last call.
+func (c *WSClient) armRead(conn *connection, received bool) {
+	now := time.Now()
+	if received && c.messageTimeout > 0 {
+		conn.messageDeadline = now.Add(c.messageTimeout)
+	}
+	c.extendRead(conn, now)
+}
+
+// extendRead moves the read deadline of conn to now plus the read timeout,
+// or to the inter-message deadline if that comes first. It is only called
+// from readPump, including the control frame handlers.
+func (c *WSClient) extendRead(conn *connection, now time.Time) {
+	var deadline time.Time
+	if c.readTimeout > 0 {
+		conn.idleDeadline = now.Add(c.readTimeout)
+		deadline = conn.idleDeadline
+	}
+	if !conn.messageDeadline.IsZero() && (deadline.IsZero() || conn.messageDeadline.Before(deadline)) {
+		deadline = conn.messageDeadline
+	}
+	if !deadline.IsZero() {
+		conn.ws.SetReadDeadline(deadline)
+	}
+}
+
+// replyPing answers a ping from the server like the default ping handler of
+// gorilla/websocket
+func replyPing(ws *websocket.Conn, appData string) error {
+	err := ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeWait))
+	var ne net.Error
+	if err == websocket.ErrCloseSent || errors.As(err, &ne) {
+		return nil
+	}
+	return err
+}
+
+// isTimeout tells whether err is a network timeout
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// timedOut returns ErrInterMessageTimeout or ErrReadTimeout if err, returned
+// by a read from conn, is caused by the deadline of that timeout, and err
+// otherwise
+func (c *WSClient) timedOut(conn *connection, err error) error {
+	if !isTimeout(err) {
+		return err
+	}
+	now := time.Now()
+	if !conn.messageDeadline.IsZero() && !now.Before(conn.messageDeadline) {
+		return ErrInterMessageTimeout
+	}
+	if !conn.idleDeadline.IsZero() && !now.Before(conn.idleDeadline) {
+		return ErrReadTimeout
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package wsclient
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterMessageTimeout(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < 2; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte("chunk"))
+			time.Sleep(50 * time.Millisecond)
+		}
+		// the stream stalls
+		conn.ReadMessage()
+	})
+
+	const timeout = 200 * time.Millisecond
+	received := make(chan time.Time, 2)
+	errs := make(chan error, 1)
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithInterMessageTimeout(timeout))
+	ws.OnMessage(func(data []byte) {
+		received <- time.Now()
+	})
+	ws.OnError(func(err error) {
+		errs <- err
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrInterMessageTimeout, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the error")
+	}
+	failed := time.Now()
+	<-received
+	last := <-received
+	gap := failed.Sub(last)
+	assert.True(t, gap >= timeout && gap < timeout+time.Second, "failed %s after the last message", gap)
+	assert.Eventually(t, func() bool {
+		return ws.CloseError() == ErrInterMessageTimeout
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReadTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		// steady traffic for several times the timeout, messages and pings
+		for i := 0; i < 12; i++ {
+			if i%2 == 0 {
+				conn.WriteMessage(websocket.TextMessage, []byte("tick"))
+			} else {
+				conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+			}
+			time.Sleep(timeout / 2)
+		}
+		// then silence
+		conn.ReadMessage()
+	})
+
+	var last atomic.Value
+	errs := make(chan error, 1)
+	ws := NewWSClient(u, WithLogger(discardLogger{}), WithReadTimeout(timeout))
+	ws.OnMessage(func(data []byte) {
+		last.Store(time.Now())
+	})
+	ws.OnError(func(err error) {
+		errs <- err
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opened := time.Now()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrReadTimeout, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the error")
+	}
+	failed := time.Now()
+	assert.True(t, failed.Sub(opened) >= 5*timeout, "failed %s after opening", failed.Sub(opened))
+	// the last frame was a ping, half a timeout after the last message
+	gap := failed.Sub(last.Load().(time.Time))
+	assert.True(t, gap >= timeout && gap < timeout+time.Second, "failed %s after the last message", gap)
+}
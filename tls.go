@@ -0,0 +1,47 @@
+package wsclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// WithTLSConfig sets the TLS configuration used to dial wss:// URLs. The
+// configuration is cloned, so later changes to cfg have no effect.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *WSClient) {
+		c.dialer.TLSClientConfig = cfg.Clone()
+	}
+}
+
+// WithClientCert adds cert to the certificates presented to servers that
+// require TLS client authentication. It can be combined with WithTLSConfig,
+// as long as it comes after it.
+func WithClientCert(cert tls.Certificate) Option {
+	return func(c *WSClient) {
+		cfg := c.dialer.TLSClientConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+		c.dialer.TLSClientConfig = cfg
+	}
+}
+
+// WithVerifyPeerCertificate sets a function called during the TLS handshake
+// of wss:// URLs with the certificates presented by the server, e.g. to pin
+// the server certificate or its public key. A non-nil error aborts the
+// handshake and is returned by the dial. fn runs after the usual
+// verification against the CA chain, which fills verifiedChains; to rely on
+// the pin alone, set InsecureSkipVerify with WithTLSConfig, in which case
+// verifiedChains is nil. It can be combined with WithTLSConfig, as long as it
+// comes after it.
+func WithVerifyPeerCertificate(fn func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) Option {
+	return func(c *WSClient) {
+		cfg := c.dialer.TLSClientConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		cfg.VerifyPeerCertificate = fn
+		c.dialer.TLSClientConfig = cfg
+	}
+}
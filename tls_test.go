@@ -0,0 +1,146 @@
+package wsclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newClientCert returns a self-signed client certificate
+func newClientCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "wsclient"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
+
+func TestClientCert(t *testing.T) {
+	cert, leaf := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	s.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	// the failed handshake is logged by the server otherwise
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	defer s.Close()
+
+	u := "wss" + strings.TrimPrefix(s.URL, "https")
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ws := NewWSClient(u, WithTLSConfig(&tls.Config{RootCAs: roots}), WithClientCert(cert))
+	if assert.NoError(t, ws.Open(ctx)) {
+		ws.Close()
+		waitShutdown(t, ws)
+	}
+
+	ws = NewWSClient(u, WithTLSConfig(&tls.Config{RootCAs: roots}))
+	assert.Error(t, ws.Open(ctx))
+}
+
+// newTLSServer starts a wss server presenting cert, or the httptest
+// certificate if cert is nil, and returns it with its wss:// URL
+func newTLSServer(t *testing.T, cert *tls.Certificate) (*httptest.Server, string) {
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	if cert != nil {
+		s.TLS = &tls.Config{Certificates: []tls.Certificate{*cert}}
+	}
+	// the failed handshake is logged by the server otherwise
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s, "wss" + strings.TrimPrefix(s.URL, "https")
+}
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	pinned, pinnedURL := newTLSServer(t, nil)
+	other, _ := newClientCert(t)
+	_, otherURL := newTLSServer(t, &other)
+
+	// pin the public key of the first server only
+	pin := sha256.Sum256(pinned.Certificate().RawSubjectPublicKeyInfo)
+	errPin := errors.New("certificate not pinned")
+	verify := func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			if sha256.Sum256(cert.RawSubjectPublicKeyInfo) == pin {
+				return nil
+			}
+		}
+		return errPin
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg := &tls.Config{InsecureSkipVerify: true}
+	ws := NewWSClient(pinnedURL, WithTLSConfig(cfg), WithVerifyPeerCertificate(verify))
+	if assert.NoError(t, ws.Open(ctx)) {
+		ws.Close()
+		waitShutdown(t, ws)
+	}
+	assert.Nil(t, cfg.VerifyPeerCertificate)
+
+	ws = NewWSClient(otherURL, WithTLSConfig(cfg), WithVerifyPeerCertificate(verify))
+	err := ws.Open(ctx)
+	assert.True(t, errors.Is(err, errPin), "got %v", err)
+}
@@ -0,0 +1,78 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+)
+
+// Names of the spans started by the client
+const (
+	SpanDial    = "wsclient.dial"
+	SpanRequest = "wsclient.request"
+)
+
+// Tracer creates the spans of a client, see WithTracer. It can be backed by
+// OpenTelemetry, by adapting a trace.Tracer for Start and a
+// propagation.TextMapPropagator with a MapCarrier for Inject, or by any other
+// tracing library.
+type Tracer interface {
+	// Start starts a span named name as a child of the span in ctx, if any,
+	// and returns it with a context carrying it
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// Inject writes the trace context of ctx into carrier, e.g. the
+	// traceparent header
+	Inject(ctx context.Context, carrier map[string]string)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	// End ends the span. err is the outcome of the operation, nil on success.
+	End(err error)
+}
+
+// WithTracer traces the client with t. A span is started for each dial, its
+// trace context sent in the handshake headers, and for each SendAndWait,
+// from the send until the response arrives or the call fails, e.g. on
+// timeout. If carrierField is not empty, the trace context of the request
+// span is also set on the request under carrierField, as an object mapping
+// the header names to their values, so the server can continue the trace.
+func WithTracer(t Tracer, carrierField string) Option {
+	return func(c *WSClient) {
+		c.tracer = t
+		c.traceField = carrierField
+	}
+}
+
+// startDialSpan starts the span of a dial and injects its trace context into
+// header, which can be nil. It returns the header to dial with.
+func (c *WSClient) startDialSpan(ctx context.Context, header http.Header) (http.Header, Span) {
+	ctx, span := c.tracer.Start(ctx, SpanDial)
+	carrier := make(map[string]string)
+	c.tracer.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return header, span
+	}
+	if header == nil {
+		header = make(http.Header)
+	} else {
+		header = header.Clone()
+	}
+	for k, v := range carrier {
+		header.Set(k, v)
+	}
+	return header, span
+}
+
+// startRequestSpan starts the span of a SendAndWait call and sets its trace
+// context on req if configured
+func (c *WSClient) startRequestSpan(ctx context.Context, req M) (context.Context, Span) {
+	ctx, span := c.tracer.Start(ctx, SpanRequest)
+	if c.traceField != "" {
+		carrier := make(map[string]string)
+		c.tracer.Inject(ctx, carrier)
+		if len(carrier) > 0 {
+			req[c.traceField] = carrier
+		}
+	}
+	return ctx, span
+}
@@ -0,0 +1,122 @@
+package wsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTracer records the spans it starts. The trace context of a span
+// is its name and number.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name  string
+	id    string
+	ended chan error
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &recordedSpan{
+		name:  name,
+		id:    name + "-" + strconv.Itoa(len(t.spans)),
+		ended: make(chan error, 1),
+	}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) Inject(ctx context.Context, carrier map[string]string) {
+	if s, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		carrier["traceparent"] = s.id
+	}
+}
+
+func (t *recordingTracer) Spans() []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*recordedSpan(nil), t.spans...)
+}
+
+func (s *recordedSpan) End(err error) {
+	select {
+	case s.ended <- err:
+	default:
+		panic("span ended twice")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	handshake := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handshake <- r.Header.Get("traceparent")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req M
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			// answer the first request only, echoing its trace context
+			if req["op"] == "ping" {
+				conn.WriteJSON(M{"id": req["id"], "trace": req["trace"]})
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	tracer := &recordingTracer{}
+	ws := NewWSClient(u, WithTracer(tracer, "trace"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.Equal(t, SpanDial+"-0", <-handshake)
+	data, err := ws.SendAndWait(ctx, M{"op": "ping"}, "id")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"1","trace":{"traceparent":"`+SpanRequest+`-1"}}`, string(data))
+
+	timeout, cancelTimeout := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelTimeout()
+	_, err = ws.SendAndWait(timeout, M{"op": "ignored"}, "id")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	spans := tracer.Spans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	assert.Equal(t, SpanDial, spans[0].name)
+	assert.Equal(t, SpanRequest, spans[1].name)
+	assert.Equal(t, SpanRequest, spans[2].name)
+	for i, want := range []error{nil, nil, context.DeadlineExceeded} {
+		select {
+		case err := <-spans[i].ended:
+			assert.Equal(t, want, err, "span %d", i)
+		default:
+			t.Errorf("span %d was not ended", i)
+		}
+	}
+}
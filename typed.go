@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+package wsclient
+
+import "encoding/json"
+
+// Typed returns a channel receiving the text messages from the server of
+// the open connection decoded from JSON into T, e.g. to range over a stream
+// of structs. The messages are passed to the channel instead of OnMessage
+// and OnTextMessage; a message that cannot be decoded into T is passed to
+// OnError instead. The channel holds up to 16 messages, after which reading
+// from the server waits for the receiver.
+//
+// The channel is closed when the connection ends, right away if the client
+// is not connected: after a reconnection, call Typed again, e.g. from
+// OnReconnect.
+func Typed[T any](c *WSClient) <-chan T {
+	out := make(chan T, subscriptionBuffer)
+	conn := c.currentConn()
+	if conn == nil {
+		close(out)
+		return out
+	}
+	conn.subscribeText(textSink{
+		deliver: func(conn *connection, data []byte) {
+			var v T
+			if err := json.Unmarshal(data, &v); err != nil {
+				c.logf("Typed: Unmarshal error: %s", err.Error())
+				c.reportError(err)
+				return
+			}
+			select {
+			case out <- v:
+			case <-conn.done:
+			case <-conn.closing:
+			}
+		},
+		end: func() {
+			close(out)
+		},
+	})
+	return out
+}
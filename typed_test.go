@@ -0,0 +1,69 @@
+//go:build go1.18
+// +build go1.18
+
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type quote struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+}
+
+func TestTyped(t *testing.T) {
+	start := make(chan bool)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		<-start
+		conn.WriteJSON(quote{"ABC", 1.5})
+		conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+		conn.WriteJSON(quote{"DEF", 2})
+		conn.WriteMessage(websocket.BinaryMessage, []byte("binary"))
+		conn.WriteJSON(quote{"GHI", 3.25})
+		// end the stream
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.ReadMessage()
+	})
+
+	errs := make(chan error, 1)
+	binary := make(chan []byte, 1)
+	ws := NewWSClient(u, WithLogger(discardLogger{}))
+	ws.OnError(func(err error) {
+		var se *json.SyntaxError
+		if assert.ErrorAs(t, err, &se) {
+			errs <- err
+		}
+	})
+	ws.OnBinaryMessage(func(data []byte) {
+		binary <- data
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	quotes := Typed[quote](ws)
+	close(start)
+	var got []quote
+	for q := range quotes {
+		got = append(got, q)
+	}
+	assert.Equal(t, []quote{{"ABC", 1.5}, {"DEF", 2}, {"GHI", 3.25}}, got)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "binary", string(<-binary))
+}
+
+func TestTypedNotConnected(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	_, ok := <-Typed[quote](ws)
+	assert.False(t, ok)
+}
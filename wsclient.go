@@ -22,18 +22,22 @@ Example:
 		fmt.Println("connection closed")
 	})
 	ws.OnError(func(err error) {
-		panic(err)
+		log.Printf("error: %s", err)
 	})
-	ws.Connect()
-
-
+	if err := ws.Open(context.Background()); err != nil {
+		panic(err)
+	}
 */
 package wsclient
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
@@ -42,162 +46,1523 @@ import (
 
 // WSClient is a WebSocket client
 type WSClient struct {
-	u        string
-	ws       *websocket.Conn
-	send     chan []byte
-	closed   bool
-	closedMu sync.RWMutex
+	u         string
+	uMu       sync.RWMutex
+	finalURL  string
+	send      chan *message
+	priority  chan *message // see SendJSONPriority
+	sendMu    sync.Mutex    // serializes the sends, so that a Batch is not interleaved
+	done      chan struct{} // closed by Close, replaced when reopened
+	closed    bool
+	draining  bool
+	closeDone chan struct{}
+	tornDown  chan struct{} // closed by Close before OnClose
+	closedMu  sync.RWMutex
+
+	conn       *connection
+	connID     uint64
+	respHeader http.Header
+	closeErr   error
+	giveUpErr  error
+	connMu     sync.RWMutex
+
+	stats   connStats
+	statsMu sync.RWMutex
+
+	// wg tracks every goroutine started by the client
+	wg sync.WaitGroup
+
+	state    State
+	watchers []chan State
+	stateMu  sync.Mutex
+
+	pending       map[string]*pendingRequest
+	pendingMu     sync.Mutex
+	pendingSlots  chan struct{}
+	pendingPolicy PendingPolicy
+	nextID        uint64
+	idGenerator   func() string
+
+	// the callbacks may be set while connected, e.g. OnMessage from OnOpen
+	cb          callbacks
+	callbacksMu sync.RWMutex
+
+	messageType        int
+	pooledBuffers      bool
+	pooledReads        bool
+	textOnlyMessages   bool
+	typeField          string
+	topicField         string
+	streamField        string
+	dialer             *websocket.Dialer
+	headerFunc         func() (http.Header, error)
+	handshakeSigner    func(req *http.Request) error
+	requireSubprotocol bool
+	readLimit          int64
+	messageTimeout     time.Duration // see WithInterMessageTimeout
+	readTimeout        time.Duration
+	strictErrors       bool
+	inboundLimit       *tokenBucket
+	reliable           *reliableDelivery
+	expectedCloseCodes []int
+	tracer             Tracer
+	traceField         string
+	pingInterval       time.Duration
+	tcpKeepAlive       time.Duration
+	closeTimeout       time.Duration
+	batchDelivery      *batchDelivery
+	asyncWorkers       int
+	name               string
+	logger             Logger
+	sendEnricher       func(M) M
+	maxRedirects       int
+	readyMatch         func([]byte) bool
+	readyTimeout       time.Duration
+	writeRetry         *writeRetry
+	keyOrder           []string
+	dedupSends         bool
+	backoff            Backoff
+	hello              M
+	outboundMiddleware []OutboundMiddleware
+	reconnect          *ReconnectConfig
+	autoPong           *autoPong
+	outboxSize         int
+	history            *history
+	frameTap           func(dir Direction, messageType int, data []byte)
+	redactPayload      func([]byte) []byte
+
+	outbox   []*message
+	offline  bool
+	outboxMu sync.Mutex
+
+	compressionLevel  int
+	writeCompression  bool
+	compressionFilter func(messageType int, data []byte) bool
+	compressionMu     sync.Mutex
+
+	probes   map[string]chan struct{}
+	probesMu sync.Mutex
+	probeID  uint64 // not nextID, so that the request ids have no gaps
+
+	receivers   []*receiver
+	receiversMu sync.Mutex
+
+	subscriptions   []*subscription
+	subscriptionsMu sync.Mutex
+
+	routes   map[string]func([]byte) // see SetHandlers
+	routesMu sync.RWMutex
+}
+
+// callbacks are the functions set by the On methods, guarded by callbacksMu
+type callbacks struct {
+	onConnecting     func()
+	onOpen           func()
+	onOpenFunc       func() error
+	onMessage        func(data []byte)
+	onTextMessage    func(data []byte)
+	onBinaryMessage  func(data []byte)
+	onUnhandledFrame func(messageType int, data []byte)
+	onReader         func(messageType int, r io.Reader)
+	onBytesRead      func(n int)
+	onBytesWritten   func(n int)
+	onSent           func(data []byte)
+	onSentCompressed func(original, wireSize int)
+	onDrop           func(data []byte, reason string)
+	onBatch          func(frames [][]byte)
+	onClose          func()
+	onDisconnect     func(info DisconnectInfo)
+	onError          func(e error)
+	onReconnect      func()
+	onGiveUp         func(err error)
+}
+
+// callbacks returns the callbacks currently set
+func (c *WSClient) callbacks() callbacks {
+	c.callbacksMu.RLock()
+	defer c.callbacksMu.RUnlock()
+	return c.cb
+}
 
-	onOpen    func()
-	onMessage func(data []byte)
-	onClose   func()
-	onError   func(e error)
+// connection is the state of a single WebSocket connection. A WSClient with
+// reconnection enabled goes through one connection per successful dial.
+type connection struct {
+	ws *websocket.Conn
+	// done is closed when the connection ends
+	done chan struct{}
+	// closing is the done channel of the client at the time of the dial
+	closing chan struct{}
+	// readDone and writeDone are closed when readPump and writePump return
+	readDone  chan struct{}
+	writeDone chan struct{}
+	// batch, if set, passes the received messages to batchLoop
+	batch chan []byte
+	// frames, if set, passes the received messages to the handlerLoop
+	// workers
+	frames chan inboundFrame
+	// ready, if set, is closed when the ready signal is received, see
+	// WithReadySignal
+	ready chan struct{}
+	once  sync.Once
+
+	// the last message written, see WithDedupConsecutiveSends
+	lastSent     []byte
+	lastSentType int
+	hasLastSent  bool
+
+	// readBuf is the buffer reused for reading, see WithPooledReadBuffers
+	readBuf *bytes.Buffer
+	// the deadlines of WithReadTimeout and WithInterMessageTimeout, only
+	// used by readPump
+	idleDeadline    time.Time
+	messageDeadline time.Time
+
+	// sinks receive the text messages, see Typed
+	sinks       []textSink
+	sinksClosed bool
+	sinksMu     sync.Mutex
+
+	connectedAt time.Time
+	stats       connStats
+	// deflate tells whether compression was negotiated
+	deflate bool
+
+	// err is the reason the connection ended
+	err   error
+	errMu sync.Mutex
+}
+
+// fail records err as the reason conn ended. The first error wins, except
+// that a close frame from the server takes precedence over an incidental
+// error, such as a write failing while the server was closing the
+// connection.
+func (conn *connection) fail(err error) {
+	conn.errMu.Lock()
+	defer conn.errMu.Unlock()
+	if conn.err == nil || (isCloseError(err) && !isCloseError(conn.err)) {
+		conn.err = err
+	}
+}
+
+// reason returns the error recorded with fail
+func (conn *connection) reason() error {
+	conn.errMu.Lock()
+	defer conn.errMu.Unlock()
+	return conn.err
+}
+
+func isCloseError(err error) bool {
+	_, ok := err.(*websocket.CloseError)
+	return ok
 }
 
 const (
 	// Time allowed to write a message to the peer.
 	writeWait = 10 * time.Second
+
+	// Time allowed to read a pending close frame after a write failed.
+	closeGracePeriod = 1 * time.Second
+)
+
+var (
+	// ErrClosed is returned when sending on a client that has been closed.
+	// It is permanent until the client is opened again.
+	ErrClosed = errors.New("wsclient: connection closed")
+	// ErrInvalidMessageType is returned for a data message type other than
+	// websocket.TextMessage or websocket.BinaryMessage
+	ErrInvalidMessageType = errors.New("wsclient: invalid message type")
+	// ErrNotConnected is returned by operations that need an open
+	// connection when there is none, e.g. before the client connected
+	ErrNotConnected = errors.New("wsclient: not connected")
+	// ErrReconnecting is returned by sends while the client is
+	// re-establishing a lost connection, see WithReconnect. The send can
+	// be retried once the client is connected again.
+	ErrReconnecting = errors.New("wsclient: reconnecting")
+
+	// ErrDraining is returned by sends after Drain was called
+	ErrDraining = errors.New("wsclient: draining")
+	// ErrAlreadyConnected is returned by Open when the client is connected,
+	// connecting or reconnecting already
+	ErrAlreadyConnected = errors.New("wsclient: already connected")
 )
 
 // M is a convenient alias for map[string]interface{}
 type M map[string]interface{}
 
+// message is an outbound frame queued for writePump
+type message struct {
+	mt   int
+	data []byte
+	// ack, if set, receives the result of writing data
+	ack chan error
+	// buf, if set, is the pooled buffer backing data
+	buf *encodeBuffer
+	// compression settings in effect when the message was queued
+	compress         bool
+	compressionLevel int
+	// deadline overrides writeWait if set
+	deadline time.Time
+	// seq is the sequence number assigned by WithReliableDelivery
+	seq uint64
+	// chunkSize, if set, is the size of the chunks written, see SendChunked
+	chunkSize int
+	// priority makes writePump write it ahead of the send buffer, see
+	// SendJSONPriority
+	priority bool
+	// retries counts the failed writes retried, see WithWriteRetry
+	retries int
+	// barrier marks a message that is not written, only acked once the
+	// messages sent before it are, see CloseGracefullyWithCode
+	barrier bool
+}
+
 // NewWSClient returns a new instance of WSClient given the WebSocket URL
-func NewWSClient(url string) *WSClient {
-	return &WSClient{
-		u:    url,
-		send: make(chan []byte),
+// and optional configuration. By default the client connects through the
+// proxy set in the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables, like net/http, see WithProxy.
+func NewWSClient(url string, opts ...Option) *WSClient {
+	c := &WSClient{
+		u:       url,
+		send:    make(chan *message),
+		done:    make(chan struct{}),
+		pending: make(map[string]*pendingRequest),
+		probes:  make(map[string]chan struct{}),
+
+		messageType:        websocket.TextMessage,
+		typeField:          "type",
+		topicField:         "topic",
+		streamField:        "stream",
+		closeTimeout:       defaultCloseTimeout,
+		expectedCloseCodes: []int{websocket.CloseNormalClosure},
+		logger:             log.Default(),
+
+		compressionLevel: defaultCompressionLevel,
+		writeCompression: true,
+	}
+	dialer := *websocket.DefaultDialer
+	c.dialer = &dialer
+	for _, opt := range opts {
+		opt(c)
 	}
+	c.priority = make(chan *message, cap(c.send))
+	if c.name == "" {
+		c.name = defaultName(url)
+	}
+	return c
+}
+
+// OnConnecting is a callback function when a connection attempt starts, for
+// the initial dial as well as for every reconnect attempt
+func (c *WSClient) OnConnecting(fn func()) {
+	c.callbacksMu.Lock()
+	c.cb.onConnecting = fn
+	c.callbacksMu.Unlock()
 }
 
 // OnOpen is a callback function when the connection is opened
 func (c *WSClient) OnOpen(fn func()) {
-	c.onOpen = fn
+	c.callbacksMu.Lock()
+	c.cb.onOpen = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnOpenFunc is a callback function when the connection is opened, after
+// OnOpen, for setup that must succeed for the client to be usable, e.g.
+// subscribing with SendAndWait. The client is only open once fn returned
+// nil: Open waits for it within its context, so a single deadline covers
+// the dial and the setup. If fn returns an error or the context is done
+// first, the client is closed and Open returns the error, or the error of
+// the context. fn should return once the client is closed, like
+// SendAndWait does.
+func (c *WSClient) OnOpenFunc(fn func() error) {
+	c.callbacksMu.Lock()
+	c.cb.onOpenFunc = fn
+	c.callbacksMu.Unlock()
 }
 
-// OnMessage is the callback function when a data is received from the server
+// OnMessage is the callback function when a data is received from the server.
+// It receives the frames that OnTextMessage and OnBinaryMessage don't handle,
+// except binary frames with WithBinaryToOnMessage(false).
 func (c *WSClient) OnMessage(fn func(data []byte)) {
-	c.onMessage = fn
+	c.callbacksMu.Lock()
+	c.cb.onMessage = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnTextMessage is the callback function when a text frame is received from
+// the server. Text frames go to OnMessage if it is not set.
+func (c *WSClient) OnTextMessage(fn func(data []byte)) {
+	c.callbacksMu.Lock()
+	c.cb.onTextMessage = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnBinaryMessage is the callback function when a binary frame is received
+// from the server. Binary frames go to OnMessage if it is not set.
+func (c *WSClient) OnBinaryMessage(fn func(data []byte)) {
+	c.callbacksMu.Lock()
+	c.cb.onBinaryMessage = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnUnhandledFrame is the callback function when a frame is received that no
+// other callback handles, such as a binary frame when only OnTextMessage is
+// set
+func (c *WSClient) OnUnhandledFrame(fn func(messageType int, data []byte)) {
+	c.callbacksMu.Lock()
+	c.cb.onUnhandledFrame = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnBytesRead is the callback function with the payload size of every data
+// frame read from the server. It is called from the read goroutine and must
+// return quickly.
+func (c *WSClient) OnBytesRead(fn func(n int)) {
+	c.callbacksMu.Lock()
+	c.cb.onBytesRead = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnBytesWritten is the callback function with the payload size of every
+// data frame written to the server. It is called from the write goroutine
+// and must return quickly.
+func (c *WSClient) OnBytesWritten(fn func(n int)) {
+	c.callbacksMu.Lock()
+	c.cb.onBytesWritten = fn
+	c.callbacksMu.Unlock()
+}
+
+// OnSent is the callback function when a message was written to the
+// connection, with the payload that was written, e.g. to account for the
+// messages that left the client with servers that send no acknowledgements.
+// Being written does not mean the server received the message. It is called
+// from the write goroutine and must return quickly; data is only valid
+// during the call.
+func (c *WSClient) OnSent(fn func(data []byte)) {
+	c.callbacksMu.Lock()
+	c.cb.onSent = fn
+	c.callbacksMu.Unlock()
 }
 
 // OnClose is the callback function when the connection is closed
 func (c *WSClient) OnClose(fn func()) {
-	c.onClose = fn
+	c.callbacksMu.Lock()
+	c.cb.onClose = fn
+	c.callbacksMu.Unlock()
+}
+
+// ResponseHeader returns the HTTP headers of the server's response to the
+// handshake of the current or last connection, e.g. to inspect the
+// negotiated Sec-WebSocket-Extensions. It returns nil if the client never
+// connected.
+func (c *WSClient) ResponseHeader() http.Header {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.respHeader
+}
+
+// CloseError returns the reason the most recent connection was lost, or nil
+// if no connection was lost since the client was opened. When the server
+// closed the connection it is a *websocket.CloseError carrying the close code
+// and reason. It can be called from OnClose to tell why the client closed.
+func (c *WSClient) CloseError() error {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.closeErr
 }
 
 // OnError is a callback function for handling errors
 func (c *WSClient) OnError(fn func(err error)) {
-	c.onError = fn
+	c.callbacksMu.Lock()
+	c.cb.onError = fn
+	c.callbacksMu.Unlock()
+}
+
+// panicUnhandled is called with the errors escalated by WithStrictErrors
+var panicUnhandled = func(err error) {
+	panic(err)
 }
 
-// Connect connects to the WebSocket server
+// reportError passes err to OnError. Without OnError the error is dropped,
+// or escalated with WithStrictErrors.
+func (c *WSClient) reportError(err error) {
+	if fn := c.callbacks().onError; fn != nil {
+		fn(err)
+		return
+	}
+	if c.strictErrors {
+		c.logf("unhandled error: %s", err.Error())
+		panicUnhandled(err)
+	}
+}
+
+// URL returns the WebSocket URL the client dials
+func (c *WSClient) URL() string {
+	c.uMu.RLock()
+	defer c.uMu.RUnlock()
+	return c.u
+}
+
+// SetURL changes the WebSocket URL the client dials, e.g. after the server
+// redirected the client to another node. An open connection is not affected;
+// the new URL is used from the next reconnect attempt on. It is safe to call
+// SetURL from any goroutine, including from callbacks.
+func (c *WSClient) SetURL(u string) {
+	c.uMu.Lock()
+	c.u = u
+	c.uMu.Unlock()
+}
+
+// Open connects to the WebSocket server and blocks until the connection is
+// ready: the handshake is complete, the read and write pumps are running and
+// OnOpen and OnOpenFunc have returned. Errors are returned to the caller
+// instead of being passed to OnError. Open is the recommended way to connect.
+// A handshake refused with a status that ReconnectConfig.RetryStatus
+// accepts, e.g. 503 during a deploy, is retried within ctx.
+//
+// Open fails with ErrAlreadyConnected if the client is connected or trying
+// to connect. A closed client can be opened again, also from OnClose; Open
+// waits for the previous connection to be torn down first.
+func (c *WSClient) Open(ctx context.Context) error {
+	return c.open(ctx)
+}
+
+// Dial is an alias of Open
+func (c *WSClient) Dial(ctx context.Context) error {
+	return c.Open(ctx)
+}
+
+// Connect connects to the WebSocket server in the background.
+//
+// Connect is the legacy asynchronous entry point, kept for compatibility: it
+// runs Open in a new goroutine and returns right away, so the caller cannot
+// tell when the connection is ready other than through OnOpen, and a dial
+// error is only logged and passed to OnError. New code should use Open.
 func (c *WSClient) Connect() {
-	go func() {
-		var err error
+	c.goroutine(func() {
 		//log.Printf("wsclient connecting to: %s", c.u)
-		c.ws, _, err = websocket.DefaultDialer.Dial(c.u, nil)
-		if err != nil {
-			fmt.Printf("Connect error: %s\n", err.Error())
-			if c.onError != nil {
-				c.onError(err)
-			}
+		if err := c.Open(context.Background()); err != nil {
+			c.logf("Connect error: %s", err.Error())
+			c.reportError(err)
 			return
 		}
 		//log.Printf("wsclient connected to: %s", c.u)
-		go c.writePump()
-		go c.readPump()
+	})
+}
 
-		if c.onOpen != nil {
-			c.onOpen()
+// open performs the handshake, starts the pumps and fires OnOpen
+func (c *WSClient) open(ctx context.Context) error {
+	if err := c.reset(ctx); err != nil {
+		return err
+	}
+	if !c.beginConnect() {
+		return ErrAlreadyConnected
+	}
+	done := c.closing()
+	ctx, cancel := c.contextUntil(ctx, done)
+	defer cancel()
+
+	if fn := c.callbacks().onConnecting; fn != nil {
+		fn()
+	}
+	ws, resp, err := c.dialRetrying(ctx)
+	if err != nil {
+		c.setState(StateDisconnected)
+		return err
+	}
+	if !c.start(ws, resp, done) {
+		return ErrClosed
+	}
+	if err := c.awaitReady(ctx, c.startedConn()); err != nil {
+		c.Close()
+		return err
+	}
+
+	cb := c.callbacks()
+	if cb.onOpen != nil {
+		cb.onOpen()
+	}
+	if cb.onOpenFunc != nil {
+		if err := c.runOpenFunc(ctx, cb.onOpenFunc); err != nil {
+			c.Close()
+			return err
 		}
-	}()
+	}
+	return nil
+}
+
+// runOpenFunc runs fn, set by OnOpenFunc, and waits for it until ctx is done
+func (c *WSClient) runOpenFunc(ctx context.Context, fn func() error) error {
+	result := make(chan error, 1)
+	c.goroutine(func() { result <- fn() })
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if isDone(c.closing()) {
+			return ErrClosed
+		}
+		return ctx.Err()
+	}
+}
+
+// dial performs the WebSocket handshake with the server
+func (c *WSClient) dial(ctx context.Context) (*websocket.Conn, *http.Response, error) {
+	return c.dialURL(ctx, c.URL())
+}
+
+// dialOnce performs the WebSocket handshake with the server at u
+func (c *WSClient) dialOnce(ctx context.Context, u string) (*websocket.Conn, *http.Response, error) {
+	var header http.Header
+	if c.headerFunc != nil {
+		h, err := c.headerFunc()
+		if err != nil {
+			return nil, nil, err
+		}
+		header = h
+	}
+	var span Span
+	if c.tracer != nil {
+		header, span = c.startDialSpan(ctx, header)
+	}
+	if c.handshakeSigner != nil {
+		h, err := c.signHandshake(ctx, u, header)
+		if err != nil {
+			if span != nil {
+				span.End(err)
+			}
+			return nil, nil, err
+		}
+		header = h
+	}
+	ws, resp, err := c.dialer.DialContext(ctx, u, header)
+	if err == nil && c.requireSubprotocol {
+		if err = c.checkSubprotocol(ws.Subprotocol()); err != nil {
+			ws.Close()
+			ws = nil
+		}
+	}
+	if span != nil {
+		span.End(err)
+	}
+	return ws, resp, err
+}
+
+// signHandshake passes the handshake request to u with header to the
+// signer set with WithHandshakeSigner and returns the headers to dial with
+func (c *WSClient) signHandshake(ctx context.Context, u string, header http.Header) (http.Header, error) {
+	if header == nil {
+		header = make(http.Header)
+	} else {
+		header = header.Clone()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	if err := c.handshakeSigner(req); err != nil {
+		return nil, err
+	}
+	return req.Header, nil
+}
+
+// reset prepares a closed client to be opened again, once its Close has
+// torn down the connection, or returns ctx.Err() if ctx is done first. The
+// callbacks and options are kept; the state of the previous connections is
+// discarded.
+func (c *WSClient) reset(ctx context.Context) error {
+	c.closedMu.RLock()
+	closed, tornDown := c.closed, c.tornDown
+	c.closedMu.RUnlock()
+	if !closed {
+		return nil
+	}
+	select {
+	case <-tornDown:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.closedMu.Lock()
+	if !c.closed {
+		// reset by a concurrent Open
+		c.closedMu.Unlock()
+		return nil
+	}
+	c.closed = false
+	c.draining = false
+	c.done = make(chan struct{})
+	c.closeDone, c.tornDown = nil, nil
+	c.closedMu.Unlock()
+	c.connMu.Lock()
+	c.closeErr = nil
+	c.giveUpErr = nil
+	c.connMu.Unlock()
+	c.setOffline(c.outboxSize > 0)
+	// sends racing with Close may have filled the buffer afterwards
+	c.dropQueued()
+	return nil
 }
 
-// SendJSON sends a JSON encoded message to the server
+// start makes ws the active connection and starts its pumps. resp is the
+// response to the handshake and done the client's done channel at the time
+// of the dial. start returns false,
+// closing ws, if the client was closed in the meantime.
+func (c *WSClient) start(ws *websocket.Conn, resp *http.Response, done chan struct{}) bool {
+	conn := &connection{
+		ws:          ws,
+		done:        make(chan struct{}),
+		closing:     done,
+		readDone:    make(chan struct{}),
+		writeDone:   make(chan struct{}),
+		connectedAt: time.Now(),
+		deflate:     c.negotiatedCompression(resp.Header),
+	}
+	c.connMu.Lock()
+	if isDone(done) {
+		c.connMu.Unlock()
+		ws.Close()
+		return false
+	}
+	c.conn = conn
+	c.connID++
+	c.respHeader = resp.Header
+	c.connMu.Unlock()
+
+	cb := c.callbacks()
+	if c.batchDelivery != nil && cb.onBatch != nil {
+		conn.batch = make(chan []byte, c.batchDelivery.maxBatch)
+		c.goroutine(func() { c.batchLoop(conn.batch) })
+	} else if c.asyncWorkers > 0 {
+		conn.frames = make(chan inboundFrame, asyncQueueSize)
+		for i := 0; i < c.asyncWorkers; i++ {
+			c.goroutine(func() { c.handlerLoop(conn.frames) })
+		}
+	}
+	if c.readyMatch != nil && cb.onReader == nil {
+		conn.ready = make(chan struct{})
+	}
+	if c.tcpKeepAlive > 0 {
+		if err := setTCPKeepAlive(ws.UnderlyingConn(), c.tcpKeepAlive); err != nil {
+			c.logf("TCP keepalive: %s", err.Error())
+		}
+	}
+	if c.readTimeout > 0 {
+		ws.SetPongHandler(func(appData string) error {
+			c.extendRead(conn, time.Now())
+			return c.handlePong(appData)
+		})
+		ws.SetPingHandler(func(appData string) error {
+			c.extendRead(conn, time.Now())
+			return replyPing(ws, appData)
+		})
+	} else {
+		ws.SetPongHandler(c.handlePong)
+	}
+	if c.readLimit > 0 {
+		ws.SetReadLimit(c.readLimit)
+	}
+	c.setState(StateConnected)
+	c.goroutine(func() { c.writePump(conn) })
+	c.goroutine(func() { c.readPump(conn) })
+	return true
+}
+
+// currentConn returns the open connection, or nil if there is none
+func (c *WSClient) currentConn() *connection {
+	c.connMu.RLock()
+	conn := c.conn
+	c.connMu.RUnlock()
+	if conn == nil {
+		return nil
+	}
+	select {
+	case <-conn.done:
+		return nil
+	default:
+		return conn
+	}
+}
+
+// disconnect ends conn after either pump stopped. Unless the client is being
+// closed by the user, the connection is re-established when reconnection is
+// enabled, and the client is closed otherwise; read and write failures are
+// handled alike.
+func (c *WSClient) disconnect(conn *connection) {
+	conn.once.Do(func() {
+		if !isDone(conn.closing) && !isDone(conn.readDone) {
+			// a write failed: give readPump the chance to read the close
+			// frame the server may have sent, whose reason takes precedence.
+			// The wait is bounded as well, since readPump may not be reading
+			// but running a callback blocked on a send, which only fails
+			// once the connection is gone.
+			conn.ws.SetReadDeadline(time.Now().Add(closeGracePeriod))
+			timer := time.NewTimer(closeGracePeriod)
+			select {
+			case <-conn.readDone:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+		close(conn.done)
+		if !isDone(conn.closing) {
+			// when closing, Close tears down the connection after the
+			// close handshake
+			conn.ws.Close()
+		}
+		if fn := c.callbacks().onDisconnect; fn != nil {
+			fn(conn.disconnectInfo())
+		}
+		if isDone(conn.closing) {
+			return
+		}
+		c.connMu.Lock()
+		c.closeErr = conn.reason()
+		c.connMu.Unlock()
+		c.setState(StateDisconnected)
+		if c.reconnect == nil {
+			c.Close()
+			return
+		}
+		if c.outboxSize > 0 {
+			c.setOffline(true)
+		}
+		c.goroutine(func() { c.reconnectLoop(conn.closing) })
+	})
+}
+
+// SendJSON sends a JSON encoded message to the server.
+//
+// Messages are handed to a single write goroutine over one channel, so the
+// messages sent from a single goroutine are written to the connection in the
+// order SendJSON was called. No ordering is defined between messages sent
+// concurrently from different goroutines.
+//
+// Sends fail with ErrNotConnected before the client is connected, with
+// ErrReconnecting while it is reconnecting after losing the connection, and
+// with ErrClosed once it is closed. The outbox, see WithOutbox, queues the
+// messages sent before connecting and while reconnecting instead. A send
+// already waiting for the writer when the connection is lost waits for the
+// new connection.
+//
+// An empty or nil M is sent as {}.
+//
+// A nil error means the message was handed to the writer, not that it
+// reached the server: a message is lost if the connection ends before or
+// while it is written. Delivery is at most once; see SendJSONAck to learn
+// whether the message was written, and WithReliableDelivery for
+// acknowledgements from the server.
 func (c *WSClient) SendJSON(j M) error {
+	m, err := c.newJSONMessage(c.messageType, j)
+	if err != nil {
+		c.logf("SendJSON: Marshal error: %s", err.Error())
+		return err
+	}
+	return c.enqueue(m)
+}
 
-	b, err := json.Marshal(j)
+// SendJSONType sends a JSON encoded message to the server like SendJSON, as
+// a frame of the given messageType instead of the default message type.
+// messageType must be websocket.TextMessage or websocket.BinaryMessage.
+func (c *WSClient) SendJSONType(messageType int, j M) error {
+	if !isDataMessageType(messageType) {
+		return ErrInvalidMessageType
+	}
+	m, err := c.newJSONMessage(messageType, j)
 	if err != nil {
-		log.Printf("SendJSON: Marshal error: %s", err.Error())
+		c.logf("SendJSONType: Marshal error: %s", err.Error())
 		return err
 	}
-	//log.Printf("Sending: '%s'", string(b))
+	return c.enqueue(m)
+}
 
-	c.send <- b
+// FireJSON sends a JSON encoded message to the server on a best effort
+// basis, e.g. for telemetry that can be lost. Unlike SendJSON it never
+// blocks and reports no error: the message is dropped if it cannot be
+// marshaled, the client is not connected, or the writer is busy with
+// another message and the send buffer, see WithSendBuffer, is full. With
+// the outbox enabled, see WithOutbox, it is queued while offline if there is
+// room.
+func (c *WSClient) FireJSON(j M) {
+	m, err := c.newJSONMessage(c.messageType, j)
+	if err != nil {
+		return
+	}
+	data := m.data
+	if m.buf != nil {
+		// the buffer goes back to the pool when the message is dropped
+		data = append([]byte(nil), data...)
+	}
+	if err := c.enqueueMessage(m, false); err != nil {
+		c.drop(data, dropReason(err))
+	}
+}
 
+// SendJSONBatch sends items to the server as a single frame holding a JSON
+// array, for servers that accept several events per message. The send
+// enricher is applied to each item. Nothing is sent if items is empty.
+func (c *WSClient) SendJSONBatch(items []M) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if c.sendEnricher != nil {
+		enriched := make([]M, len(items))
+		for i, j := range items {
+			enriched[i] = c.sendEnricher(j)
+		}
+		items = enriched
+	}
+	b, err := c.marshalBatch(items)
+	if err != nil {
+		c.logf("SendJSONBatch: Marshal error: %s", err.Error())
+		return err
+	}
+	return c.enqueue(c.newMessage(c.messageType, b))
+}
+
+// marshalBatch marshals items as a JSON array
+func (c *WSClient) marshalBatch(items []M) ([]byte, error) {
+	if len(c.keyOrder) == 0 {
+		return json.Marshal(items)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, j := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := c.marshalJSON(j)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// SendText sends a text message to the server. It is written with the
+// default message type, which is websocket.TextMessage unless changed with
+// WithDefaultMessageType. An empty text is sent as an empty frame.
+func (c *WSClient) SendText(text string) error {
+	return c.enqueue(c.newMessage(c.messageType, []byte(text)))
+}
+
+// SendBinary sends a binary message to the server. An empty or nil data is
+// sent as an empty frame.
+func (c *WSClient) SendBinary(data []byte) error {
+	return c.enqueue(c.newMessage(websocket.BinaryMessage, data))
+}
+
+// SendRaw sends data as a frame of the given messageType, which must be
+// websocket.TextMessage or websocket.BinaryMessage
+func (c *WSClient) SendRaw(messageType int, data []byte) error {
+	if !isDataMessageType(messageType) {
+		return ErrInvalidMessageType
+	}
+	return c.enqueue(c.newMessage(messageType, data))
+}
+
+// SendRawWithDeadline sends data like SendRaw, with deadline as the write
+// deadline of this frame instead of the default of 10 seconds from the start
+// of the write. It suits large payloads that take longer to write. As with
+// any write error, missing the deadline ends the connection.
+func (c *WSClient) SendRawWithDeadline(messageType int, data []byte, deadline time.Time) error {
+	if !isDataMessageType(messageType) {
+		return ErrInvalidMessageType
+	}
+	m := c.newMessage(messageType, data)
+	m.deadline = deadline
+	return c.enqueue(m)
+}
+
+// SendPreEncoded queues data to be written as is, as a frame of the given
+// messageType. The outbound middleware is skipped, which makes it suitable
+// for payloads that are already in their final wire form. messageType must
+// be websocket.TextMessage or websocket.BinaryMessage.
+func (c *WSClient) SendPreEncoded(messageType int, data []byte) error {
+	if !isDataMessageType(messageType) {
+		return ErrInvalidMessageType
+	}
+	return c.enqueue(&message{mt: messageType, data: data})
+}
+
+// SendJSONAck sends a JSON encoded message to the server like SendJSON and
+// returns a channel that receives the outcome of writing it to the
+// connection: nil once the message has been written, or the write error.
+// If the client is closed before the message is handed to the writer,
+// ErrClosed is returned instead and no channel is created.
+func (c *WSClient) SendJSONAck(j M) (<-chan error, error) {
+	m, err := c.newJSONMessage(c.messageType, j)
+	if err != nil {
+		c.logf("SendJSONAck: Marshal error: %s", err.Error())
+		return nil, err
+	}
+
+	ack := make(chan error, 1)
+	m.ack = ack
+	if err := c.enqueue(m); err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+// newJSONMessage marshals j into an outbound message of type mt
+func (c *WSClient) newJSONMessage(mt int, j M) (*message, error) {
+	j = c.enrich(j)
+	if c.reliable == nil {
+		return c.encodeJSON(mt, j)
+	}
+	j, seq := c.reliable.tag(j)
+	m, err := c.encodeJSON(mt, j)
+	if err != nil {
+		return nil, err
+	}
+	m.seq = seq
+	c.reliable.track(seq, mt, m.data)
+	return m, nil
+}
+
+// enrich returns j as it is sent, after the enricher of WithSendEnricher
+func (c *WSClient) enrich(j M) M {
+	if j == nil {
+		// sent as {} like an empty map rather than null, and safe for the
+		// enricher to add fields to
+		j = M{}
+	}
+	if c.sendEnricher != nil {
+		j = c.sendEnricher(j)
+	}
+	return j
+}
+
+// encodeJSON marshals j into an outbound message of type mt
+func (c *WSClient) encodeJSON(mt int, j M) (*message, error) {
+	if !c.pooledBuffers || len(c.keyOrder) > 0 {
+		b, err := c.marshalJSON(j)
+		if err != nil {
+			return nil, err
+		}
+		return c.newMessage(mt, b), nil
+	}
+
+	buf := getBuffer()
+	if err := buf.enc.Encode(j); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	// Encode terminates the value with a newline that Marshal does not add
+	m := c.newMessage(mt, bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	m.buf = buf
+	return m, nil
+}
+
+// newMessage returns an outbound message after running data through the
+// outbound middleware
+func (c *WSClient) newMessage(mt int, data []byte) *message {
+	for _, mw := range c.outboundMiddleware {
+		data = mw(mt, data)
+	}
+	return &message{mt: mt, data: data}
+}
+
+// enqueue hands m to writePump, or fails with ErrClosed if the client is
+// closed first
+func (c *WSClient) enqueue(m *message) error {
+	return c.enqueueMessage(m, true)
+}
+
+// errBusy is returned by enqueueMessage when it is not allowed to block and
+// the writer is not ready to take the message
+var errBusy = errors.New("wsclient: writer busy")
+
+// enqueueMessage hands m to the writer, or to the outbox while offline. If
+// block is false, it fails with errBusy rather than waiting for the writer
+// or another send.
+func (c *WSClient) enqueueMessage(m *message, block bool) error {
+	if block {
+		c.sendMu.Lock()
+	} else if !c.sendMu.TryLock() {
+		c.dropMessages([]*message{m})
+		return errBusy
+	}
+	defer c.sendMu.Unlock()
+	return c.enqueueLocked(m, block)
+}
+
+// enqueueLocked is enqueueMessage once sendMu is held. Priority messages
+// skip sendMu, so that they do not wait behind sends blocked on a full send
+// buffer.
+func (c *WSClient) enqueueLocked(m *message, block bool) (err error) {
+	if m.seq != 0 {
+		defer func() {
+			if err != nil {
+				// it was never sent, so no ack is expected
+				c.reliable.forget(m.seq)
+			}
+		}()
+	}
+	if isDone(c.closing()) {
+		// a buffered send would otherwise race with Close below
+		m.release()
+		return ErrClosed
+	}
+	if c.isDraining() {
+		m.release()
+		return ErrDraining
+	}
+	m.compress, m.compressionLevel = c.compressionSettings()
+	if m.compress && c.compressionFilter != nil {
+		m.compress = c.compressionFilter(m.mt, m.data)
+	}
+	if c.outboxSize > 0 {
+		if queued, err := c.queueOutbox(m); queued {
+			return err
+		}
+	}
+	if err := c.unavailable(); err != nil {
+		m.release()
+		return err
+	}
+	send := c.send
+	if m.priority {
+		send = c.priority
+	}
+	if !block {
+		select {
+		case send <- m:
+			return nil
+		default:
+			m.release()
+			return errBusy
+		}
+	}
+	select {
+	case send <- m:
+		return nil
+	case <-c.closing():
+		m.release()
+		return ErrClosed
+	}
+}
+
+// unavailable returns the error of a send made while there is no writePump
+// to take the message: ErrNotConnected if the client has not connected yet,
+// or failed to and is not going to retry, ErrReconnecting while it is
+// reconnecting and ErrClosed once it is closed
+func (c *WSClient) unavailable() error {
+	switch c.State() {
+	case StateIdle, StateConnecting:
+		return ErrNotConnected
+	case StateDisconnected:
+		if c.reconnect == nil {
+			return ErrNotConnected
+		}
+		return ErrReconnecting
+	case StateBackingOff, StateReconnecting:
+		return ErrReconnecting
+	case StateClosed:
+		return ErrClosed
+	}
 	return nil
 }
 
-// Close closes the connection from the server
+// Drain stops the client from sending: sends fail with ErrDraining from the
+// moment Drain returns, while the messages already sent are still written
+// and the messages from the server are still received, e.g. the responses
+// to requests in flight. Call Close once done.
+func (c *WSClient) Drain() {
+	c.closedMu.Lock()
+	c.draining = true
+	c.closedMu.Unlock()
+}
+
+func (c *WSClient) isDraining() bool {
+	c.closedMu.RLock()
+	defer c.closedMu.RUnlock()
+	return c.draining
+}
+
+// Close closes the connection from the server. Sends fail with ErrClosed from
+// the moment Close returns; the connection itself is torn down and OnClose
+// fired in the background, after a close handshake with the server bounded
+// by WithCloseTimeout. A closed client can be opened again with Open or
+// Connect.
 func (c *WSClient) Close() {
-	go func() {
-		if c.isClosed() {
-			log.Printf("Close: already closed")
-			return
-		}
-		c.closedMu.Lock()
-		c.closed = true
+	c.shutdown(websocket.CloseNormalClosure, "")
+}
+
+// shutdown closes the client like Close, with code and reason in the close
+// frame. It returns the channel closed once the client is torn down, nil if
+// it was closed already.
+func (c *WSClient) shutdown(code int, reason string) chan struct{} {
+	c.closedMu.Lock()
+	if c.closed {
 		c.closedMu.Unlock()
-		if c.ws != nil {
-			c.ws.Close()
+		c.logf("Close: already closed")
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	closeDone := make(chan struct{})
+	tornDown := make(chan struct{})
+	c.closeDone, c.tornDown = closeDone, tornDown
+	c.closedMu.Unlock()
+
+	c.goroutine(func() {
+		defer close(closeDone)
+		c.connMu.RLock()
+		conn := c.conn
+		c.connMu.RUnlock()
+		if conn != nil {
+			c.closeConnCode(conn, code, reason)
 		}
-		if c.onClose != nil {
-			c.onClose()
+		c.dropRetry()
+		c.dropOutbox()
+		c.dropQueued()
+		c.setState(StateClosed)
+		c.closeWatchers()
+		// the client can be opened again from here on, including from
+		// OnClose
+		close(tornDown)
+		if fn := c.callbacks().onClose; fn != nil {
+			fn()
 		}
-		close(c.send)
-		log.Printf("Close done")
-	}()
-	return
+		c.logf("Close done")
+	})
+	return closeDone
 }
 
-func (c *WSClient) writePump() {
+func (c *WSClient) writePump(conn *connection) {
 	defer func() {
-		c.Close()
-		log.Printf("writePump: done")
+		close(conn.writeDone)
+		c.disconnect(conn)
+		c.logf("writePump: done")
 	}()
+	if c.hello != nil && !isDone(conn.done) {
+		if err := c.writeHello(conn); err != nil {
+			c.logf("write: hello: %s", err.Error())
+			conn.fail(err)
+			return
+		}
+	}
+	if c.reliable != nil && !isDone(conn.done) {
+		if err := c.replayUnacked(conn); err != nil {
+			c.logf("write: error: %s", err.Error())
+			conn.fail(err)
+			return
+		}
+	}
+	if c.writeRetry != nil && !isDone(conn.done) {
+		if err := c.writeRetried(conn); err != nil {
+			c.logf("write: error: %s", err.Error())
+			conn.fail(err)
+			return
+		}
+	}
+	if c.outboxSize > 0 {
+		if err := c.flushOutbox(conn); err != nil {
+			c.logf("write: error: %s", err.Error())
+			conn.fail(err)
+			return
+		}
+	}
+	var ping <-chan time.Time
+	if c.pingInterval > 0 {
+		ticker := time.NewTicker(c.pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
 	for {
+		if isDone(conn.done) {
+			// the messages left in the send buffer are for the next
+			// connection, rather than lost writing them to this one
+			return
+		}
+		var err error
+		// control frames and priority messages take priority over data
+		// frames, so that they go out promptly even when many messages are
+		// queued
 		select {
-		case mesg, ok := <-c.send:
-			if !ok {
+		case <-ping:
+			err = c.writePing(conn)
+		case mesg := <-c.priority:
+			err = c.writeMessage(conn, mesg)
+		default:
+			select {
+			case <-ping:
+				err = c.writePing(conn)
+			case mesg := <-c.priority:
+				err = c.writeMessage(conn, mesg)
+			case mesg := <-c.send:
+				err = c.writeMessage(conn, mesg)
+			case <-conn.done:
 				return
-			}
-			if err := c.write(websocket.TextMessage, mesg); err != nil {
-				log.Printf("write: error: %s", err.Error())
+			case <-conn.closing:
 				return
 			}
 		}
+		if err != nil {
+			c.logf("write: error: %s", err.Error())
+			conn.fail(err)
+			return
+		}
 	}
 }
 
-func (c *WSClient) readPump() {
+// writeMessage writes m to conn and reports the result to its ack channel
+func (c *WSClient) writeMessage(conn *connection, m *message) error {
+	if m.barrier {
+		m.ack <- nil
+		return nil
+	}
+	if c.dedupSends && conn.isLastSent(m) {
+		c.drop(m.data, DropDuplicate)
+		m.release()
+		if m.ack != nil {
+			m.ack <- nil
+		}
+		return nil
+	}
+	if m.seq != 0 {
+		c.reliable.written(m.seq)
+	}
+	if c.dialer.EnableCompression {
+		// these only take effect if the server negotiated compression
+		conn.ws.EnableWriteCompression(m.compress)
+		conn.ws.SetCompressionLevel(m.compressionLevel)
+	}
+	var err error
+	if m.chunkSize > 0 {
+		err = c.writeChunked(conn.ws, m.mt, m.data, m.chunkSize)
+	} else {
+		err = c.write(conn.ws, m.mt, m.data, m.deadline)
+	}
+	if err == nil {
+		if c.dedupSends {
+			conn.rememberSent(m)
+		}
+		c.observe(conn, Outbound, m.mt, m.data)
+		cb := c.callbacks()
+		if cb.onSent != nil {
+			cb.onSent(m.data)
+		}
+		if cb.onSentCompressed != nil {
+			cb.onSentCompressed(len(m.data), compressedSize(conn, m))
+		}
+	} else if c.retryLater(conn, m, err) {
+		return err
+	}
+	m.release()
+	if m.ack != nil {
+		m.ack <- err
+	}
+	return err
+}
+
+func (c *WSClient) readPump(conn *connection) {
 	defer func() {
-		c.Close()
-		log.Printf("readPump: done")
+		if conn.batch != nil {
+			close(conn.batch)
+		}
+		if conn.frames != nil {
+			close(conn.frames)
+		}
+		conn.closeSinks()
+		close(conn.readDone)
+		c.disconnect(conn)
+		c.logf("readPump: done")
 	}()
+	timeouts := c.readTimeout > 0 || c.messageTimeout > 0
+	received := false
 	for {
-		_, message, err := c.ws.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
-				log.Printf("Read error: %s", err.Error())
+		if c.inboundLimit != nil && !c.inboundLimit.wait(conn) {
+			break
+		}
+		if timeouts {
+			c.armRead(conn, received)
+		}
+		if c.callbacks().onReader != nil {
+			if err := c.readStream(conn); err != nil {
+				c.readFailed(conn, c.timedOut(conn, err))
+				break
 			}
+			received = true
+			continue
+		}
+		mt, message, err := c.readMessage(conn)
+		if err != nil {
+			c.readFailed(conn, c.timedOut(conn, err))
 			break
 		}
-		if c.onMessage != nil {
-			c.onMessage(message)
+		received = true
+		c.observe(conn, Inbound, mt, message)
+		if conn.ready != nil && !isDone(conn.ready) && c.readyMatch(message) {
+			close(conn.ready)
+			continue
+		}
+		if c.reliable != nil {
+			c.reliable.handleAck(message)
+		}
+		if c.autoPong != nil && c.replyPong(message) {
+			continue
 		}
+		if c.deliverResponse(message) {
+			continue
+		}
+		if c.deliverReceive(message) {
+			continue
+		}
+		if c.deliverTopic(conn, message) {
+			continue
+		}
+		if c.deliverText(conn, mt, message) {
+			continue
+		}
+		if conn.batch != nil {
+			conn.batch <- c.retain(message)
+			continue
+		}
+		if conn.frames != nil {
+			conn.frames <- inboundFrame{mt: mt, data: c.retain(message)}
+			continue
+		}
+		c.dispatch(mt, message)
 	}
 }
 
-func (c *WSClient) write(mt int, payload []byte) error {
-	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
-	if mt != websocket.CloseMessage {
-		if mt == websocket.PingMessage {
-			log.Printf("mt: ping")
-		} else {
-			//log.Printf("mt: %d write: '%s'", mt, string(payload))
+// readFailed handles the error that ended reading from conn
+func (c *WSClient) readFailed(conn *connection, err error) {
+	conn.fail(err)
+	if websocket.IsUnexpectedCloseError(err, c.expectedCloseCodes...) {
+		c.logf("Read error: %s", err.Error())
+	}
+	c.readError(conn, err)
+}
+
+// readError reports the error that ended reading from conn to OnError,
+// unless the connection was closed normally, see WithExpectedCloseCodes, by
+// calling Close or after Migrate replaced it, or it is a network error,
+// typically caused by the connection being torn down. The read timeouts are
+// reported as is.
+func (c *WSClient) readError(conn *connection, err error) {
+	if isDone(conn.closing) || isDone(conn.done) ||
+		websocket.IsCloseError(err, c.expectedCloseCodes...) {
+		return
+	}
+	if err == ErrInterMessageTimeout || err == ErrReadTimeout {
+		c.reportError(err)
+		return
+	}
+	if ce := classifyError(err); ce.Kind != ErrorKindNetwork {
+		c.reportError(ce)
+	}
+}
+
+// dispatch hands a received data frame to the callback for its type
+func (c *WSClient) dispatch(mt int, data []byte) {
+	if c.route(data) {
+		return
+	}
+	cb := c.callbacks()
+	fn := cb.onMessage
+	switch {
+	case mt == websocket.TextMessage && cb.onTextMessage != nil:
+		fn = cb.onTextMessage
+	case mt == websocket.BinaryMessage && cb.onBinaryMessage != nil:
+		fn = cb.onBinaryMessage
+	case mt == websocket.BinaryMessage && c.textOnlyMessages:
+		fn = nil
+	}
+	if fn != nil {
+		fn(data)
+	} else if cb.onUnhandledFrame != nil {
+		cb.onUnhandledFrame(mt, data)
+	}
+}
+
+// observe is called for every data frame written to or read from conn
+func (c *WSClient) observe(conn *connection, dir Direction, mt int, data []byte) {
+	c.count(conn, dir, len(data))
+	if c.history != nil {
+		c.history.add(dir, mt, data)
+	}
+	if c.frameTap != nil {
+		c.frameTap(dir, mt, data)
+	}
+	if c.redactPayload != nil {
+		c.logPayload(dir, mt, data)
+	}
+}
+
+// count accounts for a data frame of n bytes written to or read from conn
+func (c *WSClient) count(conn *connection, dir Direction, n int) {
+	conn.stats.add(dir, n)
+	c.countTraffic(dir, n)
+	cb := c.callbacks()
+	if dir == Inbound && cb.onBytesRead != nil {
+		cb.onBytesRead(n)
+	} else if dir == Outbound && cb.onBytesWritten != nil {
+		cb.onBytesWritten(n)
+	}
+}
+
+// write writes a single frame to ws, failing if it is not written by
+// deadline, or within writeWait if deadline is zero.
+func (c *WSClient) write(ws *websocket.Conn, mt int, payload []byte, deadline time.Time) error {
+	if deadline.IsZero() {
+		deadline = time.Now().Add(writeWait)
+	}
+	ws.SetWriteDeadline(deadline)
+	if mt == websocket.PingMessage {
+		c.logf("mt: ping")
+	}
+	return ws.WriteMessage(mt, payload)
+}
+
+// goroutine runs fn in a new goroutine tracked by c.wg, so that the client's
+// shutdown can be awaited
+func (c *WSClient) goroutine(fn func()) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+}
+
+// contextUntil returns a copy of ctx that is also canceled when done is
+// closed, so that a pending dial does not outlive Close
+func (c *WSClient) contextUntil(ctx context.Context, done chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.goroutine(func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
 		}
+	})
+	return ctx, cancel
+}
+
+func isDataMessageType(mt int) bool {
+	return mt == websocket.TextMessage || mt == websocket.BinaryMessage
+}
+
+// closing returns the channel that is closed by Close
+func (c *WSClient) closing() chan struct{} {
+	c.closedMu.RLock()
+	defer c.closedMu.RUnlock()
+	return c.done
+}
+
+func isDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
 	}
-	return c.ws.WriteMessage(mt, payload)
 }
 
 func (c *WSClient) isClosed() bool {
@@ -1,13 +1,46 @@
 package wsclient
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
-	//"time"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
+// newTestServer starts a WebSocket server that runs handler for every
+// accepted connection and returns its ws:// URL.
+func newTestServer(t testing.TB, handler func(conn *websocket.Conn)) string {
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %s", err.Error())
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}))
+	t.Cleanup(s.Close)
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
 func TestClient(t *testing.T) {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
@@ -58,3 +91,1309 @@ func TestError(t *testing.T) {
 
 	<-done
 }
+
+func TestStrictErrors(t *testing.T) {
+	escalated := make(chan error, 2)
+	defer func(fn func(error)) { panicUnhandled = fn }(panicUnhandled)
+	panicUnhandled = func(err error) {
+		escalated <- err
+	}
+
+	// without OnError, dial errors are only escalated in strict mode
+	for _, strict := range []bool{false, true} {
+		opts := []Option{WithLogger(discardLogger{})}
+		if strict {
+			opts = append(opts, WithStrictErrors())
+		}
+		ws := NewWSClient("ws://localhost:8082", opts...)
+		ws.Connect()
+		waitShutdown(t, ws)
+	}
+	assert.Len(t, escalated, 1)
+	assert.Error(t, <-escalated)
+}
+
+func TestSendOrder(t *testing.T) {
+	const count = 200
+	done := make(chan bool)
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < count; i++ {
+			_, data, err := conn.ReadMessage()
+			if !assert.NoError(t, err) {
+				break
+			}
+			var m struct {
+				Seq int `json:"seq"`
+			}
+			assert.NoError(t, json.Unmarshal(data, &m))
+			assert.Equal(t, i, m.Seq)
+		}
+		done <- true
+	})
+
+	ws := NewWSClient(u)
+	ws.OnOpen(func() {
+		for i := 0; i < count; i++ {
+			ws.SendJSON(M{"seq": i})
+		}
+	})
+	ws.Connect()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+	ws.Close()
+}
+
+func TestSendEnricher(t *testing.T) {
+	done := make(chan bool)
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 1; i <= 3; i++ {
+			_, data, err := conn.ReadMessage()
+			if !assert.NoError(t, err) {
+				break
+			}
+			var m struct {
+				Op  string `json:"op"`
+				Seq int    `json:"seq"`
+			}
+			assert.NoError(t, json.Unmarshal(data, &m))
+			assert.Equal(t, "chat", m.Op)
+			assert.Equal(t, i, m.Seq)
+		}
+		done <- true
+	})
+
+	seq := 0
+	ws := NewWSClient(u, WithSendEnricher(func(j M) M {
+		seq++
+		j["seq"] = seq
+		return j
+	}))
+	ws.OnOpen(func() {
+		for i := 0; i < 3; i++ {
+			ws.SendJSON(M{"op": "chat"})
+		}
+	})
+	ws.Connect()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for messages")
+	}
+	ws.Close()
+}
+
+func TestOpen(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	opened := false
+	ws := NewWSClient(u)
+	ws.OnOpen(func() {
+		opened = true
+	})
+	ws.OnError(func(err error) {
+		t.Errorf("OnError called: %s", err.Error())
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, ws.Open(ctx))
+	assert.True(t, opened)
+	assert.Equal(t, StateConnected, ws.State())
+	ws.Close()
+}
+
+func TestOpenError(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	ws.OnOpen(func() {
+		t.Error("OnOpen called on failed open")
+	})
+	ws.OnError(func(err error) {
+		t.Errorf("OnError called: %s", err.Error())
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Error(t, ws.Open(ctx))
+	assert.Equal(t, StateDisconnected, ws.State())
+}
+
+func TestOnOpenFunc(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			var req M
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			// never answer the slow subscription
+			if req["op"] == "subscribe" {
+				conn.WriteJSON(M{"id": req["id"]})
+			}
+		}
+	})
+
+	open := func(timeout time.Duration, op string) (*WSClient, error) {
+		ws := NewWSClient(u)
+		ws.OnOpenFunc(func() error {
+			_, err := ws.SendAndWait(context.Background(), M{"op": op}, "id")
+			return err
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return ws, ws.Open(ctx)
+	}
+
+	ws, err := open(5*time.Second, "subscribe")
+	assert.NoError(t, err)
+	assert.Equal(t, StateConnected, ws.State())
+	ws.Close()
+	waitShutdown(t, ws)
+
+	ws, err = open(100*time.Millisecond, "slow-subscribe")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	waitShutdown(t, ws)
+	assert.Equal(t, StateClosed, ws.State())
+
+	// an error from the setup fails the open too
+	setupErr := errors.New("setup failed")
+	ws = NewWSClient(u)
+	ws.OnOpenFunc(func() error {
+		return setupErr
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Equal(t, setupErr, ws.Open(ctx))
+	waitShutdown(t, ws)
+	assert.Equal(t, StateClosed, ws.State())
+}
+
+func TestConnectLegacy(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	opened := make(chan bool)
+	ws := NewWSClient(u)
+	ws.OnOpen(func() {
+		close(opened)
+	})
+	states := ws.WatchState()
+
+	// Connect does not wait for the handshake
+	ws.Connect()
+	select {
+	case <-opened:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnOpen")
+	}
+	assert.Equal(t, StateConnecting, <-states)
+	assert.Equal(t, StateConnected, <-states)
+	ws.Close()
+}
+
+func TestDial(t *testing.T) {
+	received := make(chan []byte, 1)
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if assert.NoError(t, err) {
+			received <- data
+		}
+	})
+
+	opened := false
+	ws := NewWSClient(u)
+	ws.OnOpen(func() {
+		opened = true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	assert.True(t, opened)
+	assert.NoError(t, ws.SendJSON(M{"op": "hello"}))
+
+	select {
+	case data := <-received:
+		assert.Equal(t, []byte(`{"op":"hello"}`), data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	ws.Close()
+}
+
+func TestDialError(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	ws.OnOpen(func() {
+		t.Error("OnOpen called on failed dial")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Error(t, ws.Dial(ctx))
+}
+
+func TestSendJSONAck(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	ack, err := ws.SendJSONAck(M{"op": "hello"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case err := <-ack:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ack")
+	}
+}
+
+func TestSendJSONAckWriteError(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		<-release
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	// shut down the sending side of the socket so the next write fails
+	// while the read side stays open
+	assert.NoError(t, ws.conn.ws.UnderlyingConn().(*net.TCPConn).CloseWrite())
+
+	ack, err := ws.SendJSONAck(M{"op": "hello"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	select {
+	case err := <-ack:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ack")
+	}
+}
+
+func TestCloseErrorDuringSend(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hold"))
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "restarting"))
+		<-release
+	})
+
+	closeErr := make(chan error, 1)
+	ws := NewWSClient(u, WithLogger(discardLogger{}))
+	ws.OnMessage(func(data []byte) {
+		// hold the read side while a send fails, so the write error is
+		// seen before the close frame
+		ws.conn.ws.UnderlyingConn().(*net.TCPConn).CloseWrite()
+		ack, err := ws.SendJSONAck(M{"op": "hello"})
+		if assert.NoError(t, err) {
+			assert.Error(t, <-ack)
+		}
+	})
+	ws.OnClose(func() {
+		closeErr <- ws.CloseError()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	select {
+	case err := <-closeErr:
+		if assert.IsType(t, &websocket.CloseError{}, err) {
+			assert.Equal(t, websocket.CloseGoingAway, err.(*websocket.CloseError).Code)
+			assert.Equal(t, "restarting", err.(*websocket.CloseError).Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnClose")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestOnUnhandledFrame(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.BinaryMessage, []byte{0xde, 0xad})
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		<-release
+	})
+
+	type frame struct {
+		mt   int
+		data []byte
+	}
+	texts := make(chan string, 1)
+	unhandled := make(chan frame, 1)
+	ws := NewWSClient(u)
+	ws.OnTextMessage(func(data []byte) {
+		texts <- string(data)
+	})
+	ws.OnUnhandledFrame(func(mt int, data []byte) {
+		unhandled <- frame{mt, data}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	select {
+	case f := <-unhandled:
+		assert.Equal(t, frame{websocket.BinaryMessage, []byte{0xde, 0xad}}, f)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for unhandled frame")
+	}
+	select {
+	case text := <-texts:
+		assert.Equal(t, "hello", text)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for text frame")
+	}
+}
+
+func TestBinaryToOnMessage(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("a"))
+		conn.WriteMessage(websocket.BinaryMessage, []byte("b"))
+		conn.WriteMessage(websocket.TextMessage, []byte("c"))
+		<-release
+	})
+
+	for _, tc := range []struct {
+		deliver bool
+		want    []string
+	}{
+		{true, []string{"message a", "message b", "message c"}},
+		{false, []string{"message a", "unhandled b", "message c"}},
+	} {
+		got := make(chan string, 3)
+		ws := NewWSClient(u, WithBinaryToOnMessage(tc.deliver))
+		ws.OnMessage(func(data []byte) {
+			got <- "message " + string(data)
+		})
+		ws.OnUnhandledFrame(func(mt int, data []byte) {
+			assert.Equal(t, websocket.BinaryMessage, mt)
+			got <- "unhandled " + string(data)
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if !assert.NoError(t, ws.Open(ctx)) {
+			cancel()
+			return
+		}
+		for _, want := range tc.want {
+			select {
+			case s := <-got:
+				assert.Equal(t, want, s, "deliver %v", tc.deliver)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for message")
+			}
+		}
+		ws.Close()
+		cancel()
+		waitShutdown(t, ws)
+	}
+}
+
+func TestSendRawWithDeadline(t *testing.T) {
+	// large enough not to fit in the socket buffers, so that the write
+	// blocks until the server reads it
+	payload := make([]byte, 32<<20)
+	received := make(chan int, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		time.Sleep(500 * time.Millisecond)
+		_, data, err := conn.ReadMessage()
+		if err == nil {
+			received <- len(data)
+		}
+		conn.ReadMessage()
+	})
+
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		ok      bool
+	}{
+		{"short", 100 * time.Millisecond, false},
+		{"long", 5 * time.Second, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			disconnected := make(chan DisconnectInfo, 1)
+			ws := NewWSClient(u, WithLogger(discardLogger{}))
+			ws.OnDisconnect(func(info DisconnectInfo) {
+				disconnected <- info
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if !assert.NoError(t, ws.Open(ctx)) {
+				return
+			}
+			defer waitShutdown(t, ws)
+			defer ws.Close()
+
+			deadline := time.Now().Add(tc.timeout)
+			assert.NoError(t, ws.SendRawWithDeadline(websocket.BinaryMessage, payload, deadline))
+			if tc.ok {
+				select {
+				case n := <-received:
+					assert.Equal(t, len(payload), n)
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for payload")
+				}
+				return
+			}
+			select {
+			case info := <-disconnected:
+				var netErr net.Error
+				if assert.ErrorAs(t, info.Err, &netErr) {
+					assert.True(t, netErr.Timeout())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the write to time out")
+			}
+		})
+	}
+}
+
+func TestNetDialContext(t *testing.T) {
+	hosts := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	defer s.Close()
+
+	var addrs []string
+	ws := NewWSClient("ws://api.example.invalid/feed",
+		WithNetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			addrs = append(addrs, addr)
+			var d net.Dialer
+			return d.DialContext(ctx, network, s.Listener.Addr().String())
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	ws.Close()
+	assert.Equal(t, []string{"api.example.invalid:80"}, addrs)
+	assert.Equal(t, "api.example.invalid", <-hosts)
+	waitShutdown(t, ws)
+}
+
+func TestSendNotConnected(t *testing.T) {
+	ws := NewWSClient("ws://localhost:8082")
+	assert.Equal(t, ErrNotConnected, ws.SendJSON(M{"op": "hello"}))
+
+	// nor after failing to connect
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Error(t, ws.Open(ctx))
+	assert.Equal(t, ErrNotConnected, ws.SendText("hello"))
+}
+
+func TestFireJSON(t *testing.T) {
+	fired := func(ws *WSClient) {
+		done := make(chan bool)
+		go func() {
+			ws.FireJSON(M{"op": "telemetry"})
+			ws.FireJSON(M{"bad": make(chan int)})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("FireJSON blocked")
+		}
+	}
+
+	// never connected
+	fired(NewWSClient("ws://localhost:8082"))
+
+	// reconnecting
+	ws := NewWSClient("ws://localhost:8082", WithReconnect(ReconnectConfig{}))
+	ws.setState(StateReconnecting)
+	fired(ws)
+
+	received := make(chan string, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received <- string(data)
+		conn.ReadMessage()
+	})
+	ws = NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	// wait for the writer to be ready, as FireJSON drops the message otherwise
+	for len(received) == 0 {
+		ws.FireJSON(M{"op": "telemetry"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, `{"op":"telemetry"}`, <-received)
+}
+
+func TestSendJSONBatch(t *testing.T) {
+	frames := make(chan string, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			assert.Equal(t, websocket.TextMessage, mt)
+			frames <- string(data)
+		}
+	})
+
+	ws := NewWSClient(u, WithSendEnricher(func(j M) M {
+		j["v"] = 1
+		return j
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendJSONBatch(nil))
+	assert.NoError(t, ws.SendJSONBatch([]M{{"id": 1}, {"id": 2}, {"id": 3}}))
+	assert.NoError(t, ws.SendText("after"))
+	assert.JSONEq(t, `[{"id":1,"v":1},{"id":2,"v":1},{"id":3,"v":1}]`, <-frames)
+	assert.Equal(t, "after", <-frames)
+}
+
+func TestResponseHeader(t *testing.T) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, http.Header{
+			"X-Server-Version": {"1.2.3"},
+			"X-Session":        {"abc"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	defer s.Close()
+
+	ws := NewWSClient("ws"+strings.TrimPrefix(s.URL, "http"), WithCompression())
+	assert.Nil(t, ws.ResponseHeader())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	h := ws.ResponseHeader()
+	assert.Equal(t, "1.2.3", h.Get("X-Server-Version"))
+	assert.Equal(t, "abc", h.Get("X-Session"))
+	assert.Contains(t, h.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	assert.Equal(t, "websocket", h.Get("Upgrade"))
+}
+
+func TestIPv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %s", err.Error())
+	}
+	hosts := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	s.Listener.Close()
+	s.Listener = l
+	s.Start()
+	defer s.Close()
+
+	host := l.Addr().String()
+	assert.True(t, strings.HasPrefix(host, "[::1]:"), host)
+	ws := NewWSClient("ws://" + host + "/ws")
+	assert.Equal(t, host, ws.Name())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	assert.Equal(t, host, <-hosts)
+}
+
+func TestDrain(t *testing.T) {
+	reply := make(chan bool)
+	closeErr := make(chan error, 1)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// answer only after the client started draining
+		<-reply
+		conn.WriteMessage(websocket.TextMessage, append([]byte("re:"), data...))
+		_, _, err = conn.ReadMessage()
+		closeErr <- err
+	})
+
+	received := make(chan string, 1)
+	ws := NewWSClient(u)
+	ws.OnMessage(func(data []byte) {
+		received <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+
+	assert.NoError(t, ws.SendText("request"))
+	ws.Drain()
+	assert.Equal(t, ErrDraining, ws.SendText("late"))
+	assert.Equal(t, ErrDraining, ws.SendJSON(M{"op": "late"}))
+
+	close(reply)
+	select {
+	case data := <-received:
+		assert.Equal(t, "re:request", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the response")
+	}
+
+	ws.Close()
+	select {
+	case err := <-closeErr:
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the close frame")
+	}
+	waitShutdown(t, ws)
+}
+
+func TestSendPreEncoded(t *testing.T) {
+	type frame struct {
+		mt   int
+		data []byte
+	}
+	frames := make(chan frame, 2)
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < 2; i++ {
+			mt, data, err := conn.ReadMessage()
+			if !assert.NoError(t, err) {
+				return
+			}
+			frames <- frame{mt, data}
+		}
+	})
+
+	ws := NewWSClient(u, WithOutboundMiddleware(func(mt int, data []byte) []byte {
+		return append([]byte("mw:"), data...)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendText("hello"))
+	assert.NoError(t, ws.SendPreEncoded(websocket.BinaryMessage, []byte{0x1f, 0x8b, 0x08}))
+	// control frames are rejected before they reach the writer
+	assert.Equal(t, ErrInvalidMessageType, ws.SendPreEncoded(websocket.PingMessage, nil))
+	assert.Equal(t, ErrInvalidMessageType, ws.SendPreEncoded(0, []byte("x")))
+
+	for _, want := range []frame{
+		{websocket.TextMessage, []byte("mw:hello")},
+		{websocket.BinaryMessage, []byte{0x1f, 0x8b, 0x08}},
+	} {
+		select {
+		case f := <-frames:
+			assert.Equal(t, want, f)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+}
+
+func TestDefaultMessageType(t *testing.T) {
+	types := make(chan int, 2)
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < 2; i++ {
+			mt, _, err := conn.ReadMessage()
+			if !assert.NoError(t, err) {
+				return
+			}
+			types <- mt
+		}
+	})
+
+	ws := NewWSClient(u, WithDefaultMessageType(websocket.BinaryMessage))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Dial(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendJSON(M{"op": "hello"}))
+	assert.NoError(t, ws.SendRaw(websocket.TextMessage, []byte("hello")))
+	assert.Equal(t, ErrInvalidMessageType, ws.SendRaw(websocket.PingMessage, nil))
+
+	for _, want := range []int{websocket.BinaryMessage, websocket.TextMessage} {
+		select {
+		case mt := <-types:
+			assert.Equal(t, want, mt)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+
+	assert.Panics(t, func() {
+		WithDefaultMessageType(websocket.CloseMessage)
+	})
+}
+
+func TestSendJSONType(t *testing.T) {
+	type frame struct {
+		mt   int
+		data string
+	}
+	frames := make(chan frame, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- frame{mt, string(data)}
+		}
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	msg := M{"op": "control"}
+	assert.NoError(t, ws.SendJSONType(websocket.TextMessage, msg))
+	assert.NoError(t, ws.SendJSONType(websocket.BinaryMessage, msg))
+	assert.Equal(t, ErrInvalidMessageType, ws.SendJSONType(websocket.PingMessage, msg))
+	for _, mt := range []int{websocket.TextMessage, websocket.BinaryMessage} {
+		select {
+		case f := <-frames:
+			assert.Equal(t, frame{mt, `{"op":"control"}`}, f)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+}
+
+func TestEmptyPayloads(t *testing.T) {
+	type frame struct {
+		mt   int
+		data string
+	}
+	frames := make(chan frame, 5)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- frame{mt, string(data)}
+		}
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendJSON(M{}))
+	assert.NoError(t, ws.SendJSON(nil))
+	assert.NoError(t, ws.SendText(""))
+	assert.NoError(t, ws.SendBinary(nil))
+	assert.NoError(t, ws.SendBinary([]byte{}))
+	for _, want := range []frame{
+		{websocket.TextMessage, `{}`},
+		{websocket.TextMessage, `{}`},
+		{websocket.TextMessage, ""},
+		{websocket.BinaryMessage, ""},
+		{websocket.BinaryMessage, ""},
+	} {
+		select {
+		case f := <-frames:
+			assert.Equal(t, want, f)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+
+	// the enricher gets a map it can add fields to
+	ws = NewWSClient(u, WithSendEnricher(func(j M) M {
+		j["v"] = 1
+		return j
+	}))
+	m, err := ws.newJSONMessage(websocket.TextMessage, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"v":1}`, string(m.data))
+	}
+}
+
+// discardLogger is a Logger that drops everything
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
+
+// captureLogger is a Logger that records every line
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestDefaultName(t *testing.T) {
+	for u, want := range map[string]string{
+		"ws://example.com/feed":       "example.com",
+		"wss://example.com:8443/feed": "example.com:8443",
+		"ws://[::1]:8080/ws":          "[::1]:8080",
+		"ws://[::1]/ws":               "[::1]",
+		"ws://[fe80::1%25eth0]:80/ws": "[fe80::1%eth0]:80",
+		"not a url":                   "not a url",
+	} {
+		assert.Equal(t, want, defaultName(u), u)
+	}
+}
+
+func TestName(t *testing.T) {
+	done := make(chan bool)
+	logger := &captureLogger{}
+
+	ws := NewWSClient("ws://localhost:8082", WithName("upstream-a"), WithLogger(logger))
+	ws.OnError(func(err error) {
+		done <- true
+	})
+	ws.Connect()
+	<-done
+
+	assert.Equal(t, "upstream-a", ws.Name())
+	lines := logger.Lines()
+	if assert.NotEmpty(t, lines) {
+		for _, line := range lines {
+			assert.True(t, strings.HasPrefix(line, "[upstream-a] "), line)
+		}
+	}
+
+	assert.Equal(t, "example.com:9000", NewWSClient("ws://example.com:9000/ws").Name())
+}
+
+func TestPayloadLogging(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		mt, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(mt, data)
+		conn.ReadMessage()
+	})
+
+	logger := &captureLogger{}
+	echoed := make(chan bool)
+	ws := NewWSClient(u, WithName("test"), WithLogger(logger), WithPayloadLogging(func(data []byte) []byte {
+		var m M
+		if json.Unmarshal(data, &m) != nil {
+			return data
+		}
+		if _, ok := m["token"]; ok {
+			m["token"] = "***"
+		}
+		b, _ := json.Marshal(m)
+		return b
+	}))
+	ws.OnMessage(func(data []byte) {
+		// the redactor works on a copy
+		assert.Contains(t, string(data), "secret")
+		close(echoed)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.NoError(t, ws.SendJSON(M{"op": "auth", "token": "secret"}))
+	select {
+	case <-echoed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for echo")
+	}
+	var payloads []string
+	for _, line := range logger.Lines() {
+		assert.NotContains(t, line, "secret")
+		if strings.Contains(line, `"op":"auth"`) {
+			payloads = append(payloads, line)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		`[test] outbound text: {"op":"auth","token":"***"}`,
+		`[test] inbound text: {"op":"auth","token":"***"}`,
+	}, payloads)
+}
+
+// TestMain fails the run if any client goroutine is still running after all
+// tests finished, i.e. if some test's client was closed but leaked.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 {
+		if stacks := leakedGoroutines(2 * time.Second); stacks != "" {
+			fmt.Fprintf(os.Stderr, "leaked goroutines:\n%s", stacks)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// leakedGoroutines waits up to timeout for all client goroutines to exit and
+// returns the stacks of those still running
+func leakedGoroutines(timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		var leaked []string
+		for _, g := range strings.Split(string(buf), "\n\n") {
+			if strings.Contains(g, "wsclient.(*WSClient)") {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 {
+			return ""
+		}
+		if time.Now().After(deadline) {
+			return strings.Join(leaked, "\n\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitShutdown waits for all goroutines of ws to exit
+func waitShutdown(t *testing.T, ws *WSClient) {
+	done := make(chan bool)
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for client goroutines to exit")
+	}
+}
+
+func TestReuseAfterClose(t *testing.T) {
+	received := make(chan []byte, 2)
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- data
+		}
+	})
+
+	opens := 0
+	closed := make(chan bool, 2)
+	ws := NewWSClient(u)
+	ws.OnOpen(func() {
+		opens++
+	})
+	ws.OnClose(func() {
+		closed <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, ws.Open(ctx)) {
+			return
+		}
+		assert.NoError(t, ws.SendJSON(M{"conn": i}))
+		select {
+		case data := <-received:
+			assert.JSONEq(t, fmt.Sprintf(`{"conn":%d}`, i), string(data))
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+
+		ws.Close()
+		assert.Equal(t, ErrClosed, ws.SendJSON(M{"conn": i}))
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for close")
+		}
+	}
+	assert.Equal(t, 2, opens)
+	waitShutdown(t, ws)
+}
+
+func TestOpenFromOnClose(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	reopened := make(chan error, 1)
+	ws := NewWSClient(u)
+	first := true
+	ws.OnClose(func() {
+		if !first {
+			return
+		}
+		first = false
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		reopened <- ws.Open(ctx)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	ws.Close()
+
+	select {
+	case err := <-reopened:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Open from OnClose")
+	}
+	assert.Equal(t, StateConnected, ws.State())
+	ws.Close()
+	waitShutdown(t, ws)
+}
+
+func TestOpenAlreadyConnected(t *testing.T) {
+	var conns int32
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&conns, 1)
+		conn.ReadMessage()
+	})
+
+	ws := NewWSClient(u)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	assert.Equal(t, ErrAlreadyConnected, ws.Open(ctx))
+	assert.Equal(t, StateConnected, ws.State())
+	ws.Close()
+	waitShutdown(t, ws)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&conns))
+}
+
+func TestBufferSizes(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(mt, data)
+		}
+	})
+
+	echoed := make(chan []byte, 1)
+	ws := NewWSClient(u, WithReadBufferSize(256), WithWriteBufferSize(512))
+	ws.OnMessage(func(data []byte) {
+		echoed <- data
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+	assert.Equal(t, 256, ws.dialer.ReadBufferSize)
+	assert.Equal(t, 512, ws.dialer.WriteBufferSize)
+
+	payload := strings.Repeat("0123456789", 100000)
+	assert.NoError(t, ws.SendText(payload))
+	select {
+	case data := <-echoed:
+		assert.Equal(t, payload, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for echo")
+	}
+}
+
+func TestOnConnecting(t *testing.T) {
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+
+	for _, tc := range []struct {
+		url    string
+		events []string
+	}{
+		{u, []string{"connecting", "open"}},
+		{"ws://localhost:8082", []string{"connecting", "error"}},
+	} {
+		var events []string
+		done := make(chan bool)
+		ws := NewWSClient(tc.url)
+		ws.OnConnecting(func() {
+			events = append(events, "connecting")
+		})
+		ws.OnOpen(func() {
+			events = append(events, "open")
+			close(done)
+		})
+		ws.OnError(func(err error) {
+			events = append(events, "error")
+			close(done)
+		})
+		ws.Connect()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for connect")
+		}
+		assert.Equal(t, tc.events, events)
+		ws.Close()
+	}
+}
+
+func TestProxy(t *testing.T) {
+	// the default dialer honors the proxy environment variables
+	ws := NewWSClient("ws://localhost:8082")
+	assert.Equal(t, reflect.ValueOf(http.ProxyFromEnvironment).Pointer(), reflect.ValueOf(ws.dialer.Proxy).Pointer())
+
+	u := newTestServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		conn.ReadMessage()
+	})
+	tunneled := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tunneled <- r.Host
+		conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, err := url.Parse(proxy.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	received := make(chan string, 1)
+	ws = NewWSClient(u, WithProxy(http.ProxyURL(proxyURL)))
+	ws.OnMessage(func(data []byte) {
+		received <- string(data)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	assert.Equal(t, strings.TrimPrefix(u, "ws://"), <-tunneled)
+	select {
+	case data := <-received:
+		assert.Equal(t, "hello", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+}
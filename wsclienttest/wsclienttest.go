@@ -0,0 +1,271 @@
+/*
+Package wsclienttest provides an in-memory WebSocket server for testing code
+that uses wsclient, without opening network sockets.
+
+Connections to the server run over net.Pipe. Tests accept them one by one
+and script the server side:
+
+	s := wsclienttest.NewServer()
+	defer s.Close()
+
+	ws := wsclient.NewWSClient(s.URL(), wsclient.WithDialer(s.Dialer()))
+	if err := ws.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := s.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SendJSON(map[string]string{"type": "hello"})
+	frame, err := conn.Receive(ctx)
+*/
+package wsclienttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Number of inbound frames buffered per connection before the server stops
+// reading from the client
+const receiveBuffer = 256
+
+// Time allowed to write a frame to the client
+const writeWait = 10 * time.Second
+
+// ErrServerClosed is returned by Accept after the server was closed
+var ErrServerClosed = errors.New("wsclienttest: server closed")
+
+// Frame is a WebSocket message received by the server
+type Frame struct {
+	Type int
+	Data []byte
+}
+
+// Server is an in-memory WebSocket server
+type Server struct {
+	listener *pipeListener
+	http     *http.Server
+	accepted chan *Conn
+
+	conns   []*Conn
+	connsMu sync.Mutex
+}
+
+// NewServer starts an in-memory WebSocket server. Use its Dialer to connect
+// to it.
+func NewServer() *Server {
+	s := &Server{
+		listener: newPipeListener(),
+		accepted: make(chan *Conn, 16),
+	}
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	s.http = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			conn := newConn(ws, r)
+			s.connsMu.Lock()
+			s.conns = append(s.conns, conn)
+			s.connsMu.Unlock()
+			s.accepted <- conn
+		}),
+	}
+	go s.http.Serve(s.listener)
+	return s
+}
+
+// URL returns a WebSocket URL of the server. It only resolves through the
+// server's Dialer.
+func (s *Server) URL() string {
+	return "ws://wsclienttest/"
+}
+
+// Dialer returns a dialer that connects to the server in memory
+func (s *Server) Dialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		NetDialContext:   s.listener.DialContext,
+		HandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// Accept returns the next connection made to the server
+func (s *Server) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case conn := <-s.accepted:
+		return conn, nil
+	case <-s.listener.done:
+		return nil, ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close shuts the server down and closes all its connections
+func (s *Server) Close() {
+	s.http.Close()
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for _, conn := range s.conns {
+		conn.ws.Close()
+	}
+}
+
+// Conn is the server side of a connection to the Server
+type Conn struct {
+	// Request is the handshake request sent by the client
+	Request *http.Request
+
+	ws       *websocket.Conn
+	received chan Frame
+	err      error
+	writeMu  sync.Mutex
+}
+
+func newConn(ws *websocket.Conn, r *http.Request) *Conn {
+	conn := &Conn{
+		Request:  r,
+		ws:       ws,
+		received: make(chan Frame, receiveBuffer),
+	}
+	go conn.readLoop()
+	return conn
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.received)
+	for {
+		mt, data, err := c.ws.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.received <- Frame{Type: mt, Data: data}
+	}
+}
+
+// Receive returns the next frame sent by the client. After the connection
+// ended, it returns the error that ended it.
+func (c *Conn) Receive(ctx context.Context) (Frame, error) {
+	select {
+	case f, ok := <-c.received:
+		if !ok {
+			return Frame{}, c.err
+		}
+		return f, nil
+	case <-ctx.Done():
+		return Frame{}, ctx.Err()
+	}
+}
+
+// ReceiveJSON receives the next frame sent by the client and unmarshals it
+// into v
+func (c *Conn) ReceiveJSON(ctx context.Context, v interface{}) error {
+	f, err := c.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(f.Data, v)
+}
+
+// Send sends a frame of the given message type to the client
+func (c *Conn) Send(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteMessage(messageType, data)
+}
+
+// SendText sends a text frame to the client
+func (c *Conn) SendText(text string) error {
+	return c.Send(websocket.TextMessage, []byte(text))
+}
+
+// SendJSON sends v, encoded as JSON, in a text frame to the client
+func (c *Conn) SendJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(websocket.TextMessage, b)
+}
+
+// CloseWithCode sends a close frame with the given code and reason and
+// closes the connection
+func (c *Conn) CloseWithCode(code int, reason string) error {
+	msg := websocket.FormatCloseMessage(code, reason)
+	err := c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	c.ws.Close()
+	return err
+}
+
+// Close closes the connection without a close frame, like a dropped
+// network connection
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+// pipeListener is a net.Listener whose connections are the server ends of
+// net.Pipe pairs created by DialContext
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// DialContext connects to the listener. network and addr are ignored.
+func (l *pipeListener) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, ErrServerClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "wsclienttest" }
@@ -0,0 +1,93 @@
+package wsclienttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/tonjun/wsclient"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	received := make(chan []byte, 1)
+	ws := wsclient.NewWSClient(s.URL(), wsclient.WithDialer(s.Dialer()))
+	ws.OnMessage(func(data []byte) {
+		received <- data
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	conn, err := s.Accept(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, ws.SendJSON(wsclient.M{"op": "get-time"}))
+	var req map[string]string
+	assert.NoError(t, conn.ReceiveJSON(ctx, &req))
+	assert.Equal(t, "get-time", req["op"])
+
+	assert.NoError(t, conn.SendJSON(map[string]string{"op": "get-time-response"}))
+	select {
+	case data := <-received:
+		assert.JSONEq(t, `{"op":"get-time-response"}`, string(data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	assert.NoError(t, ws.SendBinary([]byte{1, 2, 3}))
+	f, err := conn.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, Frame{Type: websocket.BinaryMessage, Data: []byte{1, 2, 3}}, f)
+}
+
+func TestServerDrop(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	reconnected := make(chan bool, 1)
+	ws := wsclient.NewWSClient(s.URL(), wsclient.WithDialer(s.Dialer()),
+		wsclient.WithReconnect(wsclient.ReconnectConfig{InitialDelay: 10 * time.Millisecond}))
+	ws.OnReconnect(func() {
+		reconnected <- true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, ws.Open(ctx)) {
+		return
+	}
+	defer ws.Close()
+
+	conn, err := s.Accept(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn.Close()
+
+	_, err = s.Accept(ctx)
+	assert.NoError(t, err)
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reconnect")
+	}
+}
+
+func TestServerClosed(t *testing.T) {
+	s := NewServer()
+	s.Close()
+
+	ws := wsclient.NewWSClient(s.URL(), wsclient.WithDialer(s.Dialer()))
+	assert.Error(t, ws.Open(context.Background()))
+	_, err := s.Accept(context.Background())
+	assert.Equal(t, ErrServerClosed, err)
+}